@@ -19,20 +19,39 @@ package common
 const DefaultOrder = "id desc"
 const DefaultPage = 1
 const DefaultPageSize = 20
+const DefaultMaxPageSize = 1000
 const (
-	QueryTypeEqual       = "eq"
-	QueryTypeLike        = "like"
-	QueryTypeIn          = "in"
-	ParamTypeString      = "string"
-	ParamTypeNumber      = "integer"
-	ParamTypeBool        = "bool"
-	ParamTypeStringSlice = "stringSlice"
-	ParamTypeNumberSlice = "numberSlice"
+	QueryTypeEqual        = "eq"
+	QueryTypeNotEqual     = "ne"
+	QueryTypeGreater      = "gt"
+	QueryTypeGreaterEqual = "gte"
+	QueryTypeLess         = "lt"
+	QueryTypeLessEqual    = "lte"
+	QueryTypeBetween      = "between"
+	QueryTypeLike         = "like"
+	QueryTypePrefix       = "prefix"
+	QueryTypeIn           = "in"
+	QueryTypeNotIn        = "notIn"
+	QueryTypeIsNull       = "isNull"
+	ParamTypeString       = "string"
+	ParamTypeNumber       = "integer"
+	ParamTypeBool         = "bool"
+	ParamTypeStringSlice  = "stringSlice"
+	ParamTypeNumberSlice  = "numberSlice"
+)
+const (
+	QueryLogicAnd = "and"
+	QueryLogicOr  = "or"
+	QueryLogicNot = "not"
 )
 const (
 	I18nZH = "zh"
 	I18nEN = "en"
 )
+const (
+	// RequestLanguageKey 请求属性及context中保存语言的key
+	RequestLanguageKey = "RequestLanguage"
+)
 const TimeFormat = "2006-01-02 15:04:05"
 const Enable = 1
 const Disable = 0
@@ -30,6 +30,15 @@ type ClusterAuthConfig struct {
 	CaData   string `json:"caData" description:"集群CA证书"`
 }
 
+// sensitiveFields 需要加密的字段，key为字段标识
+func (ins *ClusterAuthConfig) sensitiveFields() map[string]*string {
+	return map[string]*string{
+		"clusterAuthConfig.token":    &ins.Token,
+		"clusterAuthConfig.certData": &ins.CertData,
+		"clusterAuthConfig.keyData":  &ins.KeyData,
+	}
+}
+
 func (ClusterAuthConfig) GormDataType() string {
 	return "json"
 }
@@ -40,12 +49,27 @@ func (ins *ClusterAuthConfig) Scan(value interface{}) error {
 	if !ok {
 		return errors.New(fmt.Sprint("Failed to unmarshal OpenIDConfiguration value: ", value))
 	}
-	err := json.Unmarshal(byteValue, ins)
-	return err
+	if err := json.Unmarshal(byteValue, ins); err != nil {
+		return err
+	}
+	for column, field := range ins.sensitiveFields() {
+		value, err := openField(*field, column)
+		if err != nil {
+			return err
+		}
+		*field = value
+	}
+	return nil
 }
 
-// Value 实现 driver.Valuer 接口，Value 返回 json value
+// Value 实现 driver.Valuer 接口，Value 返回 json value，开启SetEncryptSensitiveFields时Token、CertData、KeyData加密保存
 func (ins ClusterAuthConfig) Value() (driver.Value, error) {
+	var err error
+	for column, field := range ins.sensitiveFields() {
+		if *field, err = sealField(*field, column); err != nil {
+			return nil, err
+		}
+	}
 	re, err := json.Marshal(ins)
 	return re, err
 }
@@ -0,0 +1,190 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datatypes
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/efucloud/common/security"
+	"strings"
+	"sync/atomic"
+)
+
+// EncryptedPrefix 加密后的字段值前缀，没有该前缀的值作为明文读取，便于旧数据迁移
+const EncryptedPrefix = "enc:"
+
+var ErrKeyringNotConfigured = errors.New("datatypes keyring not configured")
+
+var (
+	keyring                atomic.Pointer[security.Keyring]
+	encryptSensitiveFields atomic.Bool
+)
+
+// SetKeyring 设置字段加密使用的密钥环，应在程序启动时调用
+func SetKeyring(ring *security.Keyring) {
+	keyring.Store(ring)
+}
+
+// GetKeyring 字段加密使用的密钥环
+func GetKeyring() *security.Keyring {
+	return keyring.Load()
+}
+
+// SetEncryptSensitiveFields 开启后ClusterAuthConfig的Token、CertData、KeyData及OidcConfig的ClientSecret保存时加密，
+// 读取时无论是否开启都会解密带有EncryptedPrefix的值
+func SetEncryptSensitiveFields(enable bool) {
+	encryptSensitiveFields.Store(enable)
+}
+
+// EncryptedColumn 加密字段的标识，作为关联数据参与认证，防止密文被复制到其它字段后仍能解密，
+// 一般使用空结构体实现：
+//
+//	type accountSecret struct{}
+//
+//	func (accountSecret) EncryptedColumn() string { return "account.secret" }
+type EncryptedColumn interface {
+	EncryptedColumn() string
+}
+
+// Seal 使用密钥环的当前密钥加密，associatedData为字段标识，返回带有EncryptedPrefix的文本
+func Seal(plaintext, associatedData []byte) (string, error) {
+	ring := GetKeyring()
+	if ring == nil {
+		return "", ErrKeyringNotConfigured
+	}
+	data, err := ring.Encrypt(plaintext, associatedData)
+	if err != nil {
+		return "", err
+	}
+	return EncryptedPrefix + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// Open 解密Seal生成的文本，associatedData需要与加密时相同，没有EncryptedPrefix时原样返回
+func Open(value string, associatedData []byte) ([]byte, error) {
+	if !strings.HasPrefix(value, EncryptedPrefix) {
+		return []byte(value), nil
+	}
+	ring := GetKeyring()
+	if ring == nil {
+		return nil, ErrKeyringNotConfigured
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, EncryptedPrefix))
+	if err != nil {
+		return nil, security.ErrEnvelopeInvalid
+	}
+	return ring.Decrypt(data, associatedData)
+}
+
+// sealField 开启加密时总是加密；未开启时明文带有EncryptedPrefix的值也需要加密，否则读取时会被当作密文
+func sealField(value, column string) (string, error) {
+	if len(value) == 0 || (!encryptSensitiveFields.Load() && !strings.HasPrefix(value, EncryptedPrefix)) {
+		return value, nil
+	}
+	return Seal([]byte(value), []byte(column))
+}
+
+func openField(value, column string) (string, error) {
+	data, err := Open(value, []byte(column))
+	return string(data), err
+}
+
+func columnData[C EncryptedColumn]() []byte {
+	var column C
+	return []byte(column.EncryptedColumn())
+}
+
+func scanBytes(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, errors.New(fmt.Sprint("Failed to unmarshal encrypted value: ", value))
+}
+
+// EncryptedString 保存时加密的字符串，C为字段标识
+type EncryptedString[C EncryptedColumn] string
+
+func (EncryptedString[C]) GormDataType() string {
+	return "text"
+}
+
+// Scan 实现 sql.Scanner 接口，解密数据库中的值
+func (ins *EncryptedString[C]) Scan(value interface{}) error {
+	byteValue, err := scanBytes(value)
+	if err != nil {
+		return err
+	}
+	data, err := Open(string(byteValue), columnData[C]())
+	if err != nil {
+		return err
+	}
+	*ins = EncryptedString[C](data)
+	return nil
+}
+
+// Value 实现 driver.Valuer 接口，返回加密后的值
+func (ins EncryptedString[C]) Value() (driver.Value, error) {
+	return Seal([]byte(ins), columnData[C]())
+}
+
+// EncryptedJSON 序列化为json后加密保存，C为字段标识
+type EncryptedJSON[C EncryptedColumn, T any] struct {
+	Data T
+}
+
+func NewEncryptedJSON[C EncryptedColumn, T any](data T) EncryptedJSON[C, T] {
+	return EncryptedJSON[C, T]{Data: data}
+}
+
+func (EncryptedJSON[C, T]) GormDataType() string {
+	return "text"
+}
+
+// Scan 实现 sql.Scanner 接口，解密后反序列化，未加密的旧数据直接反序列化
+func (ins *EncryptedJSON[C, T]) Scan(value interface{}) error {
+	byteValue, err := scanBytes(value)
+	if err != nil {
+		return err
+	}
+	data, err := Open(string(byteValue), columnData[C]())
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &ins.Data)
+}
+
+// Value 实现 driver.Valuer 接口，返回加密后的值
+func (ins EncryptedJSON[C, T]) Value() (driver.Value, error) {
+	data, err := json.Marshal(ins.Data)
+	if err != nil {
+		return nil, err
+	}
+	return Seal(data, columnData[C]())
+}
+
+func (ins EncryptedJSON[C, T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ins.Data)
+}
+
+func (ins *EncryptedJSON[C, T]) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &ins.Data)
+}
@@ -0,0 +1,124 @@
+package datatypes
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/efucloud/common/security"
+)
+
+type testSecretColumn struct{}
+
+func (testSecretColumn) EncryptedColumn() string { return "test.secret" }
+
+type testOtherColumn struct{}
+
+func (testOtherColumn) EncryptedColumn() string { return "test.other" }
+
+func setupKeyring(t *testing.T) {
+	key, err := security.GenerateSymmetricKey("test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring := security.NewKeyring()
+	if err = ring.Add(key); err != nil {
+		t.Fatal(err)
+	}
+	if err = ring.SetActive(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	previous := GetKeyring()
+	SetKeyring(ring)
+	t.Cleanup(func() {
+		SetKeyring(previous)
+		SetEncryptSensitiveFields(false)
+	})
+}
+
+func TestEncryptedString(t *testing.T) {
+	setupKeyring(t)
+	value, err := EncryptedString[testSecretColumn]("enc:secret").Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(value.(string), EncryptedPrefix) || strings.Contains(value.(string), "secret") {
+		t.Fatalf("value not encrypted: %v", value)
+	}
+	var secret EncryptedString[testSecretColumn]
+	if err = secret.Scan([]byte(value.(string))); err != nil || secret != "enc:secret" {
+		t.Fatalf("scan: %s, err: %v", secret, err)
+	}
+	var other EncryptedString[testOtherColumn]
+	if err = other.Scan(value); !errors.Is(err, security.ErrDecryptFailed) {
+		t.Fatalf("expected decrypt failed in other column, got %v", err)
+	}
+	if err = secret.Scan("legacy"); err != nil || secret != "legacy" {
+		t.Fatalf("scan legacy: %s, err: %v", secret, err)
+	}
+}
+
+func TestEncryptedJSON(t *testing.T) {
+	setupKeyring(t)
+	value, err := NewEncryptedJSON[testSecretColumn](map[string]string{"token": "secret"}).Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data EncryptedJSON[testSecretColumn, map[string]string]
+	if err = data.Scan(value); err != nil || data.Data["token"] != "secret" {
+		t.Fatalf("scan: %v, err: %v", data.Data, err)
+	}
+	if err = data.Scan(`{"token":"legacy"}`); err != nil || data.Data["token"] != "legacy" {
+		t.Fatalf("scan legacy: %v, err: %v", data.Data, err)
+	}
+}
+
+func TestSensitiveFields(t *testing.T) {
+	setupKeyring(t)
+	config := ClusterAuthConfig{Token: "token", KeyData: "enc:key", CaData: "ca"}
+	value, err := config.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(value.([]byte)), `"token":"token"`) || strings.Contains(string(value.([]byte)), "enc:key") {
+		t.Fatalf("unexpected value with encryption disabled: %s", value)
+	}
+	var scanned ClusterAuthConfig
+	if err = scanned.Scan(value); err != nil || scanned != config {
+		t.Fatalf("scan: %+v, err: %v", scanned, err)
+	}
+
+	SetEncryptSensitiveFields(true)
+	if value, err = config.Value(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(value.([]byte)), `"token":"token"`) || !strings.Contains(string(value.([]byte)), `"caData":"ca"`) {
+		t.Fatalf("unexpected value with encryption enabled: %s", value)
+	}
+	scanned = ClusterAuthConfig{}
+	if err = scanned.Scan(value); err != nil || scanned != config {
+		t.Fatalf("scan: %+v, err: %v", scanned, err)
+	}
+	fields := make(map[string]string)
+	if err = json.Unmarshal(value.([]byte), &fields); err != nil {
+		t.Fatal(err)
+	}
+	fields["certData"] = fields["token"]
+	swapped, _ := json.Marshal(fields)
+	if err = scanned.Scan(swapped); !errors.Is(err, security.ErrDecryptFailed) {
+		t.Fatalf("expected decrypt failed with swapped field, got %v", err)
+	}
+
+	oidc := OidcConfig{ClientID: "app", ClientSecret: "secret"}
+	if value, err = oidc.Value(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(value.([]byte)), `"clientSecret":"secret"`) {
+		t.Fatalf("client secret not encrypted: %s", value)
+	}
+	var scannedOidc OidcConfig
+	if err = scannedOidc.Scan(value); err != nil || scannedOidc.ClientSecret != "secret" {
+		t.Fatalf("scan: %+v, err: %v", scannedOidc, err)
+	}
+}
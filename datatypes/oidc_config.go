@@ -49,6 +49,9 @@ type OidcConfig struct {
 	Scopes      []string `json:"scopes" yaml:"scopes" description:"请求的域信息"`
 }
 
+// oidcClientSecretColumn ClientSecret加密时的字段标识
+const oidcClientSecretColumn = "oidcConfig.clientSecret"
+
 func (OidcConfig) GormDataType() string {
 	return "json"
 }
@@ -59,12 +62,23 @@ func (ins *OidcConfig) Scan(value interface{}) error {
 	if !ok {
 		return errors.New(fmt.Sprint("Failed to unmarshal OpenIDConfiguration value: ", value))
 	}
-	err := json.Unmarshal(byteValue, ins)
-	return err
+	if err := json.Unmarshal(byteValue, ins); err != nil {
+		return err
+	}
+	clientSecret, err := openField(ins.ClientSecret, oidcClientSecretColumn)
+	if err != nil {
+		return err
+	}
+	ins.ClientSecret = clientSecret
+	return nil
 }
 
-// Value 实现 driver.Valuer 接口，Value 返回 json value
+// Value 实现 driver.Valuer 接口，Value 返回 json value，开启SetEncryptSensitiveFields时ClientSecret加密保存
 func (ins OidcConfig) Value() (driver.Value, error) {
+	var err error
+	if ins.ClientSecret, err = sealField(ins.ClientSecret, oidcClientSecretColumn); err != nil {
+		return nil, err
+	}
 	re, err := json.Marshal(ins)
 	return re, err
 }
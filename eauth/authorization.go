@@ -0,0 +1,241 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eauth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/efucloud/common"
+	"github.com/emicklei/go-restful/v3"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"sort"
+	"sync"
+)
+
+// 组织角色及工作空间角色，admin包含edit的权限，edit包含view的权限
+const (
+	RoleAdmin = "admin"
+	RoleEdit  = "edit"
+	RoleView  = "view"
+	RoleNone  = "none"
+)
+
+const (
+	ActionView   = "view"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionManage = "manage"
+	// AnyResource 规则中匹配所有资源或者所有操作
+	AnyResource = "*"
+	AnyAction   = "*"
+)
+
+const (
+	// MetadataPermissions 路由元数据中保存[]Permission的key
+	MetadataPermissions = "eauth.permissions"
+	// MetadataPublic 路由元数据中标记无需授权的key
+	MetadataPublic = "eauth.public"
+	// WorkspaceParameter 默认从该路径参数读取工作空间
+	WorkspaceParameter = "workspace"
+)
+
+// RoleLevels 角色等级，等级高的角色包含等级低的角色的权限，自定义角色需要在初始化时加入
+var RoleLevels = map[string]int{
+	RoleNone:  0,
+	RoleView:  1,
+	RoleEdit:  2,
+	RoleAdmin: 3,
+}
+
+var (
+	ErrPermissionDenied     = errors.New("permission denied")
+	ErrPermissionUndeclared = errors.New("route permission not declared")
+)
+
+// Permission 对资源的操作
+type Permission struct {
+	Resource string `json:"resource" yaml:"resource" description:"资源"`
+	Action   string `json:"action" yaml:"action" description:"操作"`
+}
+
+func (p Permission) String() string {
+	return p.Resource + ":" + p.Action
+}
+
+// RequirePermission 路由需要的权限，用于RouteBuilder.Metadata，如：
+// ws.GET("/apps").Metadata(eauth.RequirePermission("app", eauth.ActionView))
+func RequirePermission(resource string, actions ...string) (string, interface{}) {
+	permissions := make([]Permission, 0, len(actions))
+	for _, action := range actions {
+		permissions = append(permissions, Permission{Resource: resource, Action: action})
+	}
+	return MetadataPermissions, permissions
+}
+
+// RequirePermissions 路由需要的多个资源的权限，用于RouteBuilder.Metadata
+func RequirePermissions(permissions ...Permission) (string, interface{}) {
+	return MetadataPermissions, permissions
+}
+
+// Public 标记路由无需授权，用于RouteBuilder.Metadata
+func Public() (string, interface{}) {
+	return MetadataPublic, true
+}
+
+// RoutePermissions 从路由元数据读取声明的权限及是否无需授权
+func RoutePermissions(metadata map[string]interface{}) (permissions []Permission, public bool) {
+	permissions, _ = metadata[MetadataPermissions].([]Permission)
+	public, _ = metadata[MetadataPublic].(bool)
+	return permissions, public
+}
+
+// Policy 权限策略，每个权限对应需要的最低角色，组织角色对所有工作空间生效，工作空间角色只对该工作空间生效
+type Policy struct {
+	mutex sync.RWMutex
+	rules map[Permission]string
+}
+
+// NewPolicy 默认规则：view需要view角色，create、update、delete需要edit角色，manage需要admin角色
+func NewPolicy() *Policy {
+	policy := &Policy{rules: make(map[Permission]string)}
+	policy.Allow(Permission{Resource: AnyResource, Action: ActionView}, RoleView)
+	policy.Allow(Permission{Resource: AnyResource, Action: ActionCreate}, RoleEdit)
+	policy.Allow(Permission{Resource: AnyResource, Action: ActionUpdate}, RoleEdit)
+	policy.Allow(Permission{Resource: AnyResource, Action: ActionDelete}, RoleEdit)
+	policy.Allow(Permission{Resource: AnyResource, Action: ActionManage}, RoleAdmin)
+	return policy
+}
+
+// Allow 设置权限需要的最低角色，Resource、Action可以为*
+func (p *Policy) Allow(permission Permission, role string) *Policy {
+	if _, exist := RoleLevels[role]; !exist {
+		panic(fmt.Sprintf("role %s not defined in RoleLevels", role))
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.rules[permission] = role
+	return p
+}
+
+// RequiredRole 权限需要的最低角色，依次匹配资源:操作、资源:*、*:操作、*:*
+func (p *Policy) RequiredRole(permission Permission) (role string, exist bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	for _, candidate := range []Permission{
+		permission,
+		{Resource: permission.Resource, Action: AnyAction},
+		{Resource: AnyResource, Action: permission.Action},
+		{Resource: AnyResource, Action: AnyAction},
+	} {
+		if role, exist = p.rules[candidate]; exist {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+// Roles 拥有该权限的所有角色，按等级从高到低排列
+func (p *Policy) Roles(permission Permission) (roles []string) {
+	required, exist := p.RequiredRole(permission)
+	if !exist {
+		return nil
+	}
+	for role, level := range RoleLevels {
+		if level > 0 && level >= RoleLevels[required] {
+			roles = append(roles, role)
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return RoleLevels[roles[i]] > RoleLevels[roles[j]]
+	})
+	return roles
+}
+
+func hasRole(role, required string) bool {
+	level, exist := RoleLevels[role]
+	return exist && level > 0 && level >= RoleLevels[required]
+}
+
+// Can 判断是否拥有权限，AppOwner拥有所有权限，workspace为空时只根据组织角色判断
+func (p *Policy) Can(claims AccountClaims, action, resource, workspace string) bool {
+	required, exist := p.RequiredRole(Permission{Resource: resource, Action: action})
+	if !exist {
+		return false
+	}
+	if claims.AppOwner || hasRole(claims.Role, required) {
+		return true
+	}
+	if len(workspace) == 0 || !common.StringInArray(workspace, claims.Workspaces) {
+		return false
+	}
+	for _, role := range claims.WorkspacesRoles[workspace] {
+		if hasRole(role, required) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizationFilterConfig 授权过滤器配置，需要在NewAuthFilter之后使用
+type AuthorizationFilterConfig struct {
+	Policy *Policy
+	Bundle *i18n.Bundle
+	// Workspace 获取请求的工作空间，为空时读取workspace路径参数
+	Workspace func(req *restful.Request) string
+	// Strict 为true时拒绝既未声明权限也未标记为Public的路由
+	Strict bool
+}
+
+// NewAuthorizationFilter 根据路由元数据MetadataPermissions校验权限，需要满足所有权限，
+// 路由标记为Public或者未声明权限时不校验（Strict时未声明权限返回403），未认证时返回401，无权限时返回403
+func NewAuthorizationFilter(config AuthorizationFilterConfig) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		var permissions []Permission
+		var public bool
+		if route := req.SelectedRoute(); route != nil {
+			permissions, public = RoutePermissions(route.Metadata())
+		}
+		lang := common.GetLanguageFromReq(req, common.RequestLanguageKey)
+		if public || (len(permissions) == 0 && !config.Strict) {
+			chain.ProcessFilter(req, resp)
+			return
+		}
+		if len(permissions) == 0 {
+			common.ResponseErrorMessage(req.Request.Context(), req, resp, config.Bundle,
+				common.Forbidden(fmt.Errorf("%w: %s %s", ErrPermissionUndeclared, req.Request.Method, req.SelectedRoutePath())).ErrorData(lang))
+			return
+		}
+		claims, ok := ClaimsFromRequest(req)
+		if !ok {
+			common.ResponseErrorMessage(req.Request.Context(), req, resp, config.Bundle, common.Unauthorized(ErrTokenMissing).ErrorData(lang))
+			return
+		}
+		workspace := req.PathParameter(WorkspaceParameter)
+		if config.Workspace != nil {
+			workspace = config.Workspace(req)
+		}
+		for _, permission := range permissions {
+			if !config.Policy.Can(claims, permission.Action, permission.Resource, workspace) {
+				common.ResponseErrorMessage(req.Request.Context(), req, resp, config.Bundle,
+					common.Forbidden(fmt.Errorf("%w: %s", ErrPermissionDenied, permission)).ErrorData(lang))
+				return
+			}
+		}
+		chain.ProcessFilter(req, resp)
+	}
+}
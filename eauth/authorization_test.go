@@ -0,0 +1,96 @@
+package eauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/efucloud/common"
+	"github.com/emicklei/go-restful/v3"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+func TestPolicyCan(t *testing.T) {
+	policy := NewPolicy().
+		Allow(Permission{Resource: "cluster", Action: ActionDelete}, RoleAdmin).
+		Allow(Permission{Resource: "audit", Action: AnyAction}, RoleAdmin)
+	member := AccountClaims{
+		Role:            RoleNone,
+		Workspaces:      []string{"dev", "test"},
+		WorkspacesRoles: map[string][]string{"dev": {RoleEdit}, "test": {RoleView}, "prod": {RoleAdmin}},
+	}
+	cases := []struct {
+		name      string
+		claims    AccountClaims
+		action    string
+		resource  string
+		workspace string
+		expected  bool
+	}{
+		{"org admin", AccountClaims{Role: RoleAdmin}, ActionDelete, "cluster", "", true},
+		{"org edit inherits view", AccountClaims{Role: RoleEdit}, ActionView, "cluster", "dev", true},
+		{"org edit can not delete cluster", AccountClaims{Role: RoleEdit}, ActionDelete, "cluster", "", false},
+		{"org view can not create", AccountClaims{Role: RoleView}, ActionCreate, "app", "", false},
+		{"app owner", AccountClaims{AppOwner: true}, ActionManage, "audit", "", true},
+		{"workspace edit", member, ActionUpdate, "app", "dev", true},
+		{"workspace edit can not manage", member, ActionManage, "app", "dev", false},
+		{"workspace view", member, ActionView, "app", "test", true},
+		{"workspace view can not update", member, ActionUpdate, "app", "test", false},
+		{"role of workspace not joined", member, ActionView, "app", "prod", false},
+		{"no workspace", member, ActionView, "app", "", false},
+		{"resource wildcard action", AccountClaims{Role: RoleEdit}, ActionView, "audit", "", false},
+		{"undeclared action", AccountClaims{Role: RoleAdmin}, "approve", "app", "", false},
+	}
+	for _, c := range cases {
+		if got := policy.Can(c.claims, c.action, c.resource, c.workspace); got != c.expected {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, got)
+		}
+	}
+	if roles := policy.Roles(Permission{Resource: "app", Action: ActionUpdate}); len(roles) != 2 || roles[0] != RoleAdmin || roles[1] != RoleEdit {
+		t.Errorf("unexpected roles: %v", roles)
+	}
+}
+
+func TestAuthorizationFilter(t *testing.T) {
+	policy := NewPolicy().Allow(Permission{Resource: "app", Action: ActionUpdate}, RoleEdit)
+	for _, strict := range []bool{false, true} {
+		container := restful.NewContainer()
+		ws := new(restful.WebService)
+		ws.Filter(func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+			if role := req.HeaderParameter("X-Role"); len(role) > 0 {
+				req.SetAttribute(common.RequestClaimsKey, AccountClaims{Role: role})
+			}
+			chain.ProcessFilter(req, resp)
+		})
+		ws.Filter(NewAuthorizationFilter(AuthorizationFilterConfig{Policy: policy, Bundle: i18n.NewBundle(language.Chinese), Strict: strict}))
+		handler := func(req *restful.Request, resp *restful.Response) {}
+		ws.Route(ws.PUT("/apps/{id}").To(handler).Metadata(RequirePermission("app", ActionUpdate)))
+		ws.Route(ws.GET("/health").To(handler).Metadata(Public()))
+		ws.Route(ws.GET("/undeclared").To(handler))
+		container.Add(ws)
+		undeclared := http.StatusOK
+		if strict {
+			undeclared = http.StatusForbidden
+		}
+		cases := []struct {
+			method, path, role string
+			expected           int
+		}{
+			{"PUT", "/apps/1", "", http.StatusUnauthorized},
+			{"PUT", "/apps/1", RoleView, http.StatusForbidden},
+			{"PUT", "/apps/1", RoleEdit, http.StatusOK},
+			{"GET", "/health", "", http.StatusOK},
+			{"GET", "/undeclared", RoleAdmin, undeclared},
+		}
+		for _, c := range cases {
+			req := httptest.NewRequest(c.method, c.path, nil)
+			req.Header.Set("X-Role", c.role)
+			recorder := httptest.NewRecorder()
+			container.ServeHTTP(recorder, req)
+			if recorder.Code != c.expected {
+				t.Errorf("strict: %v, %s %s role %q: expected %d, got %d", strict, c.method, c.path, c.role, c.expected, recorder.Code)
+			}
+		}
+	}
+}
@@ -74,9 +74,18 @@ type AccountClaims struct {
 	AppClientID     string              `json:"appClientId"`
 	AppOwner        bool                `json:"appOwner"`
 	Category        string              `json:"category"`
+	SessionID       string              `json:"sid,omitempty"`       // 登录会话，用于按会话撤销令牌
+	AuthTime        int64               `json:"auth_time,omitempty"` // 用户登录认证的时间，登录时设置，刷新令牌时保持不变
 	jwt.RegisteredClaims
 }
 
+// LocalLoginParam的登录方式
+const (
+	LoginMethodPassword  = "password"
+	LoginMethodPhoneCode = "phoneCode"
+	LoginMethodEmailCode = "emailCode"
+)
+
 // LocalLoginParam 本地登录请求
 type LocalLoginParam struct {
 	Method      string `json:"method" validate:"oneof=password phoneCode emailCode"` // 登录类型，用户名密码/手机验证码/邮箱验证码/
@@ -87,7 +96,7 @@ type LocalLoginParam struct {
 	ValidCode   string `json:"validCode"`
 	Code        string `json:"code"`
 	State       string `json:"state"`
-	RedirectUri string `json:"redirectUri" validate:"required"`
+	RedirectUri string `json:"redirectUri" validate:"required,uri"` // 必须在应用注册的重定向地址中，见LoginTransactionManager，可以为相对地址
 	Bind        string `json:"bind"`
 }
 type TokenResponse struct {
@@ -99,12 +108,15 @@ type TokenResponse struct {
 }
 
 type RefreshToken struct {
+	ID        string `json:"id,omitempty"`     // 令牌摘要，令牌本身不保存
+	Family    string `json:"family,omitempty"` // 同一次登录轮换产生的令牌属于同一个family
 	Org       string `json:"org"`
 	App       string `json:"app"`
 	ExpiresIn int64  `json:"expiresIn"`
 	AccountID uint   `json:"accountId"`
 	Issuer    string `json:"issuer"`
 	Provider  string `json:"provider"`
+	AuthTime  int64  `json:"authTime,omitempty"` // 登录认证的时间，刷新时写回AccountClaims.AuthTime
 }
 
 type AccountSync struct {
@@ -0,0 +1,105 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eauth
+
+import (
+	"context"
+	"errors"
+	"github.com/efucloud/common"
+	"github.com/emicklei/go-restful/v3"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"go.uber.org/zap"
+	"strings"
+)
+
+type claimsContextKey struct{}
+
+// AuthFilterConfig 认证过滤器配置
+type AuthFilterConfig struct {
+	Verifier              *TokenVerifier
+	CookieName            string // 请求头中没有Bearer令牌时从该cookie读取，为空时不读取
+	AuthorizationEndpoint string // 认证失败时返回给前端的认证地址
+	Bundle                *i18n.Bundle
+	// Params 认证失败时返回给前端的重定向参数，可以为空
+	Params func(req *restful.Request) map[string]interface{}
+	// Logger 记录认证失败的详细原因，响应中只返回通用信息，可以为空
+	Logger *zap.SugaredLogger
+}
+
+// NewAuthFilter 从Authorization头或者cookie中读取令牌并校验，成功后将AccountClaims写入请求属性及context，
+// 失败时通过ResponseAuthRedirect返回401，响应中不包含令牌解析及密钥的错误细节
+func NewAuthFilter(config AuthFilterConfig) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		claims, err := config.Verifier.VerifyContext(req.Request.Context(), TokenFromRequest(req, config.CookieName))
+		if err != nil {
+			if config.Logger != nil {
+				config.Logger.Debugf("authenticate request %s %s failed, err: %s", req.Request.Method, req.Request.URL.Path, err.Error())
+			}
+			var params map[string]interface{}
+			if config.Params != nil {
+				params = config.Params(req)
+			}
+			common.ResponseAuthRedirect(req.Request.Context(), resp, config.Bundle,
+				common.GetLanguageFromReq(req, common.RequestLanguageKey), authFailureMessage(err), config.AuthorizationEndpoint, params)
+			return
+		}
+		req.SetAttribute(common.RequestClaimsKey, claims)
+		req.Request = req.Request.WithContext(ContextWithClaims(req.Request.Context(), claims))
+		chain.ProcessFilter(req, resp)
+	}
+}
+
+// authFailureMessage 只返回令牌缺失、已撤销及无效三种通用信息
+func authFailureMessage(err error) string {
+	switch {
+	case errors.Is(err, ErrTokenMissing):
+		return ErrTokenMissing.Error()
+	case errors.Is(err, ErrTokenRevoked):
+		return ErrTokenRevoked.Error()
+	}
+	return ErrTokenInvalid.Error()
+}
+
+// TokenFromRequest 读取Bearer令牌，cookieName不为空时请求头中不存在则从cookie读取
+func TokenFromRequest(req *restful.Request, cookieName string) string {
+	authorization := strings.TrimSpace(req.HeaderParameter("Authorization"))
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	if len(cookieName) > 0 {
+		if cookie, err := req.Request.Cookie(cookieName); err == nil {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func ContextWithClaims(ctx context.Context, claims AccountClaims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromRequest 获取认证过滤器写入的AccountClaims
+func ClaimsFromRequest(req *restful.Request) (claims AccountClaims, ok bool) {
+	claims, ok = req.Attribute(common.RequestClaimsKey).(AccountClaims)
+	return
+}
+
+// ClaimsFromContext 获取认证过滤器写入的AccountClaims
+func ClaimsFromContext(ctx context.Context) (claims AccountClaims, ok bool) {
+	claims, ok = ctx.Value(claimsContextKey{}).(AccountClaims)
+	return
+}
@@ -0,0 +1,40 @@
+package eauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/efucloud/common"
+	"github.com/emicklei/go-restful/v3"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+func TestAuthFilterMessage(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	filter := NewAuthFilter(AuthFilterConfig{
+		Verifier: &TokenVerifier{VerifyKeys: []*rsa.PublicKey{&key.PublicKey}},
+		Bundle:   i18n.NewBundle(language.Chinese),
+	})
+	container := restful.NewContainer()
+	ws := new(restful.WebService)
+	ws.Route(ws.GET("/me").Filter(filter).To(func(req *restful.Request, resp *restful.Response) {}))
+	container.Add(ws)
+	for token, expected := range map[string]string{"": ErrTokenMissing.Error(), "not.a.jwt": ErrTokenInvalid.Error()} {
+		req := httptest.NewRequest("GET", "/me", nil)
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		container.ServeHTTP(recorder, req)
+		var body common.AuthRedirectInfo
+		_ = json.Unmarshal(recorder.Body.Bytes(), &body)
+		if recorder.Code != http.StatusUnauthorized || body.Message != expected {
+			t.Fatalf("token: %q, code: %d, message: %q", token, recorder.Code, body.Message)
+		}
+	}
+}
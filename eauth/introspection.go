@@ -0,0 +1,274 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eauth
+
+import (
+	"context"
+	"errors"
+	"github.com/efucloud/common"
+	"github.com/emicklei/go-restful/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"time"
+)
+
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// IntrospectionRequest RFC 7662 令牌内省请求，以表单提交
+type IntrospectionRequest struct {
+	Token         string `json:"token" description:"令牌"`
+	TokenTypeHint string `json:"token_type_hint,omitempty" description:"令牌类型，access_token或refresh_token"`
+}
+
+// IntrospectionResponse RFC 7662 令牌内省响应，令牌无效时只返回active=false
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Nbf       int64    `json:"nbf,omitempty"`
+	Sub       string   `json:"sub,omitempty"`
+	Aud       []string `json:"aud,omitempty"`
+	Iss       string   `json:"iss,omitempty"`
+	Jti       string   `json:"jti,omitempty"`
+	Sid       string   `json:"sid,omitempty"`
+	Org       string   `json:"org,omitempty"`
+}
+
+// RevocationRequest RFC 7009 令牌撤销请求，以表单提交
+type RevocationRequest struct {
+	Token         string `json:"token" description:"令牌"`
+	TokenTypeHint string `json:"token_type_hint,omitempty" description:"令牌类型，access_token或refresh_token"`
+}
+
+var (
+	ErrClientAuthenticatorMissing = errors.New("client authenticator is not configured")
+	// ErrTokenTypeUnsupported 未配置Revocation时访问令牌不能撤销
+	ErrTokenTypeUnsupported = errors.New("unsupported token type")
+)
+
+// ClientAuthenticator 认证调用端点的客户端，返回客户端的ClientID
+type ClientAuthenticator func(req *restful.Request) (clientID string, err error)
+
+// TokenEndpoints 令牌内省及撤销端点，RefreshTokens为空时不支持刷新令牌，
+// Authenticate为空时端点拒绝所有请求
+type TokenEndpoints struct {
+	Verifier      *TokenVerifier
+	Revocation    RevocationStore
+	RefreshTokens *RefreshTokenManager
+	Authenticate  ClientAuthenticator
+}
+
+func numericDate(date *jwt.NumericDate) int64 {
+	if date == nil {
+		return 0
+	}
+	return date.Unix()
+}
+
+// Introspect 内省令牌，hint只决定尝试的顺序
+func (e *TokenEndpoints) Introspect(ctx context.Context, request IntrospectionRequest) (response IntrospectionResponse) {
+	if len(request.Token) == 0 {
+		return response
+	}
+	if request.TokenTypeHint != TokenTypeHintRefreshToken {
+		if response, ok := e.introspectAccessToken(ctx, request.Token); ok {
+			return response
+		}
+	}
+	if response, ok := e.introspectRefreshToken(ctx, request.Token); ok {
+		return response
+	}
+	if request.TokenTypeHint == TokenTypeHintRefreshToken {
+		if response, ok := e.introspectAccessToken(ctx, request.Token); ok {
+			return response
+		}
+	}
+	return IntrospectionResponse{}
+}
+
+func (e *TokenEndpoints) introspectAccessToken(ctx context.Context, token string) (response IntrospectionResponse, ok bool) {
+	if e.Verifier == nil {
+		return response, false
+	}
+	claims, err := e.Verifier.VerifyContext(ctx, token)
+	if err != nil {
+		return response, false
+	}
+	// Verifier未配置撤销列表时，通过本端点撤销的令牌同样需要返回active=false
+	if e.Revocation != nil {
+		if revoked, err := e.Revocation.IsRevoked(ctx, claims); err != nil || revoked {
+			return response, false
+		}
+	}
+	return IntrospectionResponse{
+		Active:    true,
+		ClientID:  claims.AppClientID,
+		Username:  claims.Username,
+		TokenType: TokenTypeBearer,
+		Exp:       numericDate(claims.ExpiresAt),
+		Iat:       numericDate(claims.IssuedAt),
+		Nbf:       numericDate(claims.NotBefore),
+		Sub:       claims.Subject,
+		Aud:       claims.Audience,
+		Iss:       claims.Issuer,
+		Jti:       claims.ID,
+		Sid:       claims.SessionID,
+		Org:       claims.Org,
+	}, true
+}
+
+func (e *TokenEndpoints) introspectRefreshToken(ctx context.Context, token string) (response IntrospectionResponse, ok bool) {
+	if e.RefreshTokens == nil {
+		return response, false
+	}
+	record, err := e.RefreshTokens.Store.Get(ctx, RefreshTokenID(token))
+	if err != nil || record.Rotated || record.Revoked || time.Now().After(record.ExpiresAt) {
+		return response, false
+	}
+	return IntrospectionResponse{
+		Active: true,
+		Exp:    record.ExpiresAt.Unix(),
+		Iat:    record.CreatedAt.Unix(),
+		Iss:    record.Issuer,
+		Org:    record.Org,
+		Aud:    []string{record.App},
+	}, true
+}
+
+// Revoke 撤销令牌，令牌无效时不返回错误，令牌不属于clientID时返回ErrTokenClientMismatch(RFC 7009 2.1)，
+// token_type_hint只决定查找的顺序，与令牌类型不符时继续查找其它类型
+func (e *TokenEndpoints) Revoke(ctx context.Context, clientID string, request RevocationRequest) error {
+	if len(request.Token) == 0 {
+		return nil
+	}
+	if request.TokenTypeHint != TokenTypeHintRefreshToken {
+		if found, err := e.revokeAccessToken(ctx, clientID, request.Token); found {
+			return err
+		}
+	}
+	if found, err := e.revokeRefreshToken(ctx, clientID, request.Token); found {
+		return err
+	}
+	if request.TokenTypeHint == TokenTypeHintRefreshToken {
+		if found, err := e.revokeAccessToken(ctx, clientID, request.Token); found {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeAccessToken found表示token为有效的访问令牌
+func (e *TokenEndpoints) revokeAccessToken(ctx context.Context, clientID, token string) (found bool, err error) {
+	if e.Verifier == nil {
+		return false, nil
+	}
+	claims, err := e.Verifier.VerifyContext(ctx, token)
+	if err != nil {
+		return false, nil
+	}
+	if claims.AppClientID != clientID {
+		return true, ErrTokenClientMismatch
+	}
+	if e.Revocation == nil || claims.ExpiresAt == nil {
+		return true, ErrTokenTypeUnsupported
+	}
+	return true, e.Revocation.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// revokeRefreshToken found表示token为已保存的刷新令牌，查询失败时同样返回true
+func (e *TokenEndpoints) revokeRefreshToken(ctx context.Context, clientID, token string) (found bool, err error) {
+	if e.RefreshTokens == nil {
+		return false, nil
+	}
+	record, err := e.RefreshTokens.Store.Get(ctx, RefreshTokenID(token))
+	if errors.Is(err, ErrRefreshTokenInvalid) {
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+	if record.App != clientID {
+		return true, ErrTokenClientMismatch
+	}
+	return true, e.RefreshTokens.Store.RevokeFamily(ctx, record.Family)
+}
+
+// authenticate 未配置Authenticate或者认证失败时返回401
+func (e *TokenEndpoints) authenticate(req *restful.Request, resp *restful.Response) (clientID string, ok bool) {
+	err := ErrClientAuthenticatorMissing
+	if e.Authenticate != nil {
+		if clientID, err = e.Authenticate(req); err == nil && len(clientID) == 0 {
+			err = errors.New("client id is empty")
+		}
+	}
+	if err != nil {
+		resp.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		_ = common.TokenErr(resp, "invalid_client", err.Error(), http.StatusUnauthorized)
+		return "", false
+	}
+	return clientID, true
+}
+
+// IntrospectionHandler RFC 7662 令牌内省端点
+func (e *TokenEndpoints) IntrospectionHandler(req *restful.Request, resp *restful.Response) {
+	if _, ok := e.authenticate(req, resp); !ok {
+		return
+	}
+	if err := req.Request.ParseForm(); err != nil {
+		_ = common.TokenErr(resp, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+	response := e.Introspect(req.Request.Context(), IntrospectionRequest{
+		Token:         req.Request.PostFormValue("token"),
+		TokenTypeHint: req.Request.PostFormValue("token_type_hint"),
+	})
+	resp.Header().Set("Cache-Control", "no-store")
+	common.ResponseSuccess(resp, response)
+}
+
+// RevocationHandler RFC 7009 令牌撤销端点，令牌无效时同样返回200
+func (e *TokenEndpoints) RevocationHandler(req *restful.Request, resp *restful.Response) {
+	clientID, ok := e.authenticate(req, resp)
+	if !ok {
+		return
+	}
+	if err := req.Request.ParseForm(); err != nil {
+		_ = common.TokenErr(resp, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := e.Revoke(req.Request.Context(), clientID, RevocationRequest{
+		Token:         req.Request.PostFormValue("token"),
+		TokenTypeHint: req.Request.PostFormValue("token_type_hint"),
+	})
+	switch {
+	case err == nil:
+		resp.WriteHeader(http.StatusOK)
+	case errors.Is(err, ErrTokenClientMismatch):
+		_ = common.TokenErr(resp, "unauthorized_client", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrTokenTypeUnsupported):
+		_ = common.TokenErr(resp, "unsupported_token_type", err.Error(), http.StatusBadRequest)
+	default:
+		_ = common.TokenErr(resp, "server_error", err.Error(), http.StatusInternalServerError)
+	}
+}
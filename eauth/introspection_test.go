@@ -0,0 +1,145 @@
+package eauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+func TestTokenEndpoints(t *testing.T) {
+	ctx := context.Background()
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, _ := NewSigningKey("k1", privateKey)
+	issuer := &TokenIssuer{Issuer: "https://auth.example.com", KeyRing: NewKeyRing(key), RefreshTokens: NewRefreshTokenManager(NewMemoryRefreshTokenStore())}
+	response, err := issuer.Issue(ctx, AccountClaims{Username: "admin", AppClientID: "app"}, nil, &RefreshToken{App: "app", AccountID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints := &TokenEndpoints{Verifier: issuer.Verifier(), Revocation: NewMemoryRevocationStore(), RefreshTokens: issuer.RefreshTokens}
+	container := restful.NewContainer()
+	ws := new(restful.WebService)
+	ws.Route(ws.POST("/introspect").To(endpoints.IntrospectionHandler))
+	ws.Route(ws.POST("/revoke").To(endpoints.RevocationHandler))
+	container.Add(ws)
+	call := func(path, client string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Client", client)
+		recorder := httptest.NewRecorder()
+		container.ServeHTTP(recorder, req)
+		return recorder
+	}
+	introspect := func(token string) IntrospectionResponse {
+		recorder := call("/introspect", "rs", url.Values{"token": {token}})
+		var result IntrospectionResponse
+		if recorder.Code != http.StatusOK || json.Unmarshal(recorder.Body.Bytes(), &result) != nil {
+			t.Fatalf("introspect code: %d, body: %s", recorder.Code, recorder.Body.String())
+		}
+		return result
+	}
+
+	// 未配置客户端认证时拒绝请求
+	if recorder := call("/introspect", "rs", url.Values{"token": {response.AccessToken}}); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without authenticator, got %d", recorder.Code)
+	}
+	if recorder := call("/revoke", "app", url.Values{"token": {response.AccessToken}}); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without authenticator, got %d", recorder.Code)
+	}
+	endpoints.Authenticate = func(req *restful.Request) (string, error) {
+		return req.HeaderParameter("X-Client"), nil
+	}
+	if recorder := call("/introspect", "", url.Values{"token": {response.AccessToken}}); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for empty client, got %d", recorder.Code)
+	}
+
+	if result := introspect(response.AccessToken); !result.Active || result.ClientID != "app" {
+		t.Fatalf("access token should be active: %+v", result)
+	}
+	if result := introspect(response.RefreshToken); !result.Active {
+		t.Fatalf("refresh token should be active: %+v", result)
+	}
+
+	// 其他客户端不能撤销令牌
+	for _, token := range []string{response.AccessToken, response.RefreshToken} {
+		if recorder := call("/revoke", "other", url.Values{"token": {token}}); recorder.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for other client, got %d", recorder.Code)
+		}
+		if !introspect(token).Active {
+			t.Fatal("token revoked by other client")
+		}
+	}
+	if err = endpoints.Revoke(ctx, "other", RevocationRequest{Token: response.RefreshToken, TokenTypeHint: TokenTypeHintRefreshToken}); !errors.Is(err, ErrTokenClientMismatch) {
+		t.Fatalf("expected client mismatch, got: %v", err)
+	}
+
+	for _, token := range []string{response.AccessToken, response.RefreshToken} {
+		if recorder := call("/revoke", "app", url.Values{"token": {token}}); recorder.Code != http.StatusOK {
+			t.Fatalf("revoke code: %d, body: %s", recorder.Code, recorder.Body.String())
+		}
+		if introspect(token).Active {
+			t.Fatal("revoked token should be inactive")
+		}
+	}
+	if recorder := call("/revoke", "app", url.Values{"token": {"unknown"}}); recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200 for unknown token, got %d", recorder.Code)
+	}
+}
+
+type failingRefreshTokenStore struct {
+	RefreshTokenStore
+}
+
+func (failingRefreshTokenStore) Get(ctx context.Context, id string) (RefreshTokenRecord, error) {
+	return RefreshTokenRecord{}, errors.New("database unavailable")
+}
+
+func TestRevokeTokenTypeHint(t *testing.T) {
+	ctx := context.Background()
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, _ := NewSigningKey("k1", privateKey)
+	issuer := &TokenIssuer{Issuer: "https://auth.example.com", KeyRing: NewKeyRing(key), RefreshTokens: NewRefreshTokenManager(NewMemoryRefreshTokenStore())}
+	accessToken, _, err := issuer.IssueAccessToken(AccountClaims{Username: "admin", AppClientID: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 提示与令牌类型不符时继续查找访问令牌
+	endpoints := &TokenEndpoints{Verifier: issuer.Verifier(), Revocation: NewMemoryRevocationStore(), RefreshTokens: issuer.RefreshTokens}
+	if err = endpoints.Revoke(ctx, "app", RevocationRequest{Token: accessToken, TokenTypeHint: TokenTypeHintRefreshToken}); err != nil {
+		t.Fatal(err)
+	}
+	if endpoints.Introspect(ctx, IntrospectionRequest{Token: accessToken}).Active {
+		t.Fatal("access token revoked with refresh_token hint should be inactive")
+	}
+
+	// 未配置Revocation时访问令牌不能撤销，刷新令牌存储的错误不作为unsupported_token_type
+	endpoints = &TokenEndpoints{Verifier: issuer.Verifier(), RefreshTokens: issuer.RefreshTokens}
+	if err = endpoints.Revoke(ctx, "app", RevocationRequest{Token: accessToken}); !errors.Is(err, ErrTokenTypeUnsupported) {
+		t.Fatalf("expected unsupported token type, got: %v", err)
+	}
+	endpoints.RefreshTokens = NewRefreshTokenManager(failingRefreshTokenStore{})
+	endpoints.Authenticate = func(req *restful.Request) (string, error) {
+		return "app", nil
+	}
+	container := restful.NewContainer()
+	ws := new(restful.WebService)
+	ws.Route(ws.POST("/revoke").To(endpoints.RevocationHandler))
+	container.Add(ws)
+	req := httptest.NewRequest("POST", "/revoke", strings.NewReader(url.Values{"token": {"opaque"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	container.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusInternalServerError || !strings.Contains(recorder.Body.String(), "server_error") {
+		t.Fatalf("expected server_error, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,357 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/efucloud/common"
+	"github.com/efucloud/common/datatypes"
+	"github.com/efucloud/common/security"
+	"github.com/emicklei/go-restful/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TokenTypeBearer = "Bearer"
+	// TokenTypeAccess 访问令牌的typ头，RFC 9068
+	TokenTypeAccess = "at+jwt"
+
+	DefaultAccessTokenTTL = time.Hour
+	DefaultIDTokenTTL     = time.Hour
+	// JwksPath JWKS的默认发布路径
+	JwksPath = "/.well-known/jwks.json"
+)
+
+var (
+	ErrSigningKeyNotFound = errors.New("signing key not found")
+	ErrIDTokenAudience    = errors.New("id token audience can not be empty")
+)
+
+// SigningKey 签名密钥，Method根据私钥类型确定
+type SigningKey struct {
+	KeyID      string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+}
+
+// NewSigningKey 支持RSA(RS256)、ECDSA P-256(ES256)及Ed25519(EdDSA)私钥
+func NewSigningKey(kid string, privateKey crypto.Signer) (key SigningKey, err error) {
+	if len(kid) == 0 {
+		return key, errors.New("signing key id can not be empty")
+	}
+	key = SigningKey{KeyID: kid, PrivateKey: privateKey}
+	switch k := privateKey.(type) {
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return key, fmt.Errorf("unsupported ecdsa curve: %s", k.Curve.Params().Name)
+		}
+		key.Method = jwt.SigningMethodES256
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return key, fmt.Errorf("unsupported private key type: %T", privateKey)
+	}
+	return key, nil
+}
+
+// KeyRing 签名密钥环，active用于签名，retired仅用于校验轮换前签发且尚未过期的令牌
+type KeyRing struct {
+	mutex   sync.RWMutex
+	active  SigningKey
+	retired []SigningKey
+}
+
+func NewKeyRing(active SigningKey, retired ...SigningKey) *KeyRing {
+	return &KeyRing{active: active, retired: retired}
+}
+
+// Active 当前签名密钥
+func (r *KeyRing) Active() SigningKey {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.active
+}
+
+// Rotate 使用新的密钥签名，原密钥转为retired
+func (r *KeyRing) Rotate(key SigningKey) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.retired = append([]SigningKey{r.active}, r.retired...)
+	r.active = key
+}
+
+// Remove 移除retired密钥，该密钥签发的令牌全部过期后调用
+func (r *KeyRing) Remove(kid string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var retired []SigningKey
+	for _, key := range r.retired {
+		if key.KeyID != kid {
+			retired = append(retired, key)
+		}
+	}
+	r.retired = retired
+}
+
+// Keys 所有密钥，第一个为active
+func (r *KeyRing) Keys() []SigningKey {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]SigningKey{r.active}, r.retired...)
+}
+
+// JWKS 所有密钥的公钥
+func (r *KeyRing) JWKS() (keySet security.JSONWebKeySet, err error) {
+	keySet.Keys = []security.JSONWebKey{}
+	for _, key := range r.Keys() {
+		jwk, err := security.NewJSONWebKey(key.PrivateKey.Public(), key.KeyID, key.Method.Alg())
+		if err != nil {
+			return keySet, err
+		}
+		keySet.Keys = append(keySet.Keys, jwk)
+	}
+	return keySet, nil
+}
+
+// Keyfunc 根据kid选择公钥，可用作TokenVerifier.Keyfunc
+func (r *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	for _, key := range r.Keys() {
+		if key.KeyID == kid && key.Method.Alg() == token.Method.Alg() {
+			return key.PrivateKey.Public(), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: kid: %s", ErrSigningKeyNotFound, kid)
+}
+
+// SigningMethods 所有密钥使用的签名算法
+func (r *KeyRing) SigningMethods() (methods []string) {
+	for _, key := range r.Keys() {
+		if !common.StringInArray(key.Method.Alg(), methods) {
+			methods = append(methods, key.Method.Alg())
+		}
+	}
+	return methods
+}
+
+// IDTokenClaims OIDC ID Token
+type IDTokenClaims struct {
+	Nonce         string   `json:"nonce,omitempty"`
+	AuthTime      int64    `json:"auth_time,omitempty"`
+	Org           string   `json:"org,omitempty"`
+	Username      string   `json:"preferred_username,omitempty"`
+	Nickname      string   `json:"nickname,omitempty"`
+	Email         string   `json:"email,omitempty"`
+	EmailVerified bool     `json:"email_verified,omitempty"`
+	Phone         string   `json:"phone_number,omitempty"`
+	Profile       string   `json:"profile,omitempty"`
+	Groups        []string `json:"groups,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TokenIssuer 签发访问令牌、ID Token及刷新令牌，TTL为0时使用默认值
+type TokenIssuer struct {
+	Issuer         string
+	KeyRing        *KeyRing
+	AccessTokenTTL time.Duration
+	IDTokenTTL     time.Duration
+	RefreshTokens  *RefreshTokenManager // 刷新令牌为不透明令牌，由RefreshTokenManager保存及轮换
+}
+
+func (i *TokenIssuer) ttl(ttl, defaultTTL time.Duration) time.Duration {
+	if ttl > 0 {
+		return ttl
+	}
+	return defaultTTL
+}
+
+func (i *TokenIssuer) sign(claims jwt.Claims, typ string) (string, error) {
+	key := i.KeyRing.Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.KeyID
+	if len(typ) > 0 {
+		token.Header["typ"] = typ
+	}
+	return token.SignedString(key.PrivateKey)
+}
+
+func (i *TokenIssuer) registeredClaims(subject string, audience []string, ttl time.Duration) jwt.RegisteredClaims {
+	now := time.Now()
+	return jwt.RegisteredClaims{
+		Issuer:    i.Issuer,
+		Subject:   subject,
+		Audience:  audience,
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        common.NewID(),
+	}
+}
+
+func accountSubject(claims AccountClaims) string {
+	if len(claims.Subject) > 0 {
+		return claims.Subject
+	}
+	return claims.GetUsername()
+}
+
+// IssueAccessToken 签发访问令牌，iss、iat、nbf、exp、jti由签发者设置，aud为空时使用AppClientID
+func (i *TokenIssuer) IssueAccessToken(claims AccountClaims) (tokenStr string, expiresIn int64, err error) {
+	ttl := i.ttl(i.AccessTokenTTL, DefaultAccessTokenTTL)
+	audience := claims.Audience
+	if len(audience) == 0 && len(claims.AppClientID) > 0 {
+		audience = jwt.ClaimStrings{claims.AppClientID}
+	}
+	claims.RegisteredClaims = i.registeredClaims(accountSubject(claims), audience, ttl)
+	tokenStr, err = i.sign(claims, TokenTypeAccess)
+	return tokenStr, int64(ttl.Seconds()), err
+}
+
+// IssueIDToken 签发ID Token，user可以为nil，aud为AppClientID，不能为空，auth_time使用claims.AuthTime
+func (i *TokenIssuer) IssueIDToken(claims AccountClaims, user *UserInfo) (string, error) {
+	if len(claims.AppClientID) == 0 {
+		return "", ErrIDTokenAudience
+	}
+	idClaims := IDTokenClaims{
+		Nonce:    claims.Nonce,
+		AuthTime: claims.AuthTime,
+		Org:      claims.Org,
+		Username: claims.Username,
+		Nickname: claims.Nickname,
+		Email:    claims.Email,
+		Phone:    claims.Phone,
+		Groups:   claims.Groups,
+	}
+	if user != nil {
+		idClaims.EmailVerified = user.EmailVerified
+		idClaims.Profile = user.Profile
+	}
+	idClaims.RegisteredClaims = i.registeredClaims(accountSubject(claims), jwt.ClaimStrings{claims.AppClientID}, i.ttl(i.IDTokenTTL, DefaultIDTokenTTL))
+	return i.sign(idClaims, "")
+}
+
+// Issue 签发访问令牌、ID Token及刷新令牌，refreshToken为nil或者未配置RefreshTokens时不签发刷新令牌，
+// 登录时claims.AuthTime需要设置为用户认证的时间
+func (i *TokenIssuer) Issue(ctx context.Context, claims AccountClaims, user *UserInfo, refreshToken *RefreshToken) (response TokenResponse, err error) {
+	response.TokenType = TokenTypeBearer
+	if response.AccessToken, response.ExpiresIn, err = i.IssueAccessToken(claims); err != nil {
+		return response, err
+	}
+	if response.IDToken, err = i.IssueIDToken(claims, user); err != nil {
+		return response, err
+	}
+	if refreshToken != nil && i.RefreshTokens != nil {
+		refreshToken.Issuer = i.Issuer
+		if refreshToken.AuthTime == 0 {
+			refreshToken.AuthTime = claims.AuthTime
+		}
+		if response.RefreshToken, _, err = i.RefreshTokens.Create(ctx, *refreshToken); err != nil {
+			return response, err
+		}
+	}
+	return response, nil
+}
+
+// Refresh 轮换刷新令牌并签发新的令牌，load根据刷新令牌加载最新的账号信息
+func (i *TokenIssuer) Refresh(ctx context.Context, token string,
+	load func(ctx context.Context, refreshToken RefreshToken) (AccountClaims, *UserInfo, error)) (response TokenResponse, err error) {
+	if i.RefreshTokens == nil {
+		return response, ErrRefreshTokenInvalid
+	}
+	newToken, refreshToken, err := i.RefreshTokens.Rotate(ctx, token)
+	if err != nil {
+		return response, err
+	}
+	claims, user, err := load(ctx, refreshToken)
+	if err != nil {
+		return response, err
+	}
+	if claims.AuthTime == 0 {
+		claims.AuthTime = refreshToken.AuthTime
+	}
+	if response, err = i.Issue(ctx, claims, user, nil); err != nil {
+		return response, err
+	}
+	response.RefreshToken = newToken
+	return response, nil
+}
+
+// Verifier 校验本签发者签发的访问令牌，要求typ为TokenTypeAccess，同一密钥签发的ID Token不能作为访问令牌使用，
+// audience不为空时令牌的aud需要包含其中之一
+func (i *TokenIssuer) Verifier(audience ...string) *TokenVerifier {
+	return &TokenVerifier{Keyfunc: i.KeyRing.Keyfunc, Type: TokenTypeAccess, Issuer: i.Issuer, Audience: audience,
+		Methods: i.KeyRing.SigningMethods()}
+}
+
+// OpenIDConfiguration 生成discovery文档，base中未设置的字段使用默认值
+func (i *TokenIssuer) OpenIDConfiguration(base datatypes.OpenIDConfiguration) datatypes.OpenIDConfiguration {
+	issuer := strings.TrimSuffix(i.Issuer, "/")
+	base.Issuer = i.Issuer
+	if len(base.JwksUri) == 0 {
+		base.JwksUri = issuer + JwksPath
+	}
+	if len(base.ResponseTypesSupported) == 0 {
+		base.ResponseTypesSupported = []string{"code"}
+	}
+	if len(base.GrantTypesSupported) == 0 {
+		base.GrantTypesSupported = []string{"authorization_code", "refresh_token"}
+	}
+	if len(base.SubjectTypesSupported) == 0 {
+		base.SubjectTypesSupported = []string{"public"}
+	}
+	if len(base.ScopesSupported) == 0 {
+		base.ScopesSupported = []string{"openid", "profile", "email", "phone", "offline_access"}
+	}
+	if len(base.ClaimsSupported) == 0 {
+		base.ClaimsSupported = []string{"iss", "sub", "aud", "exp", "iat", "nonce", "auth_time", "org",
+			"preferred_username", "nickname", "email", "email_verified", "phone_number", "profile", "groups"}
+	}
+	base.IdTokenSigningAlgValuesSupported = i.KeyRing.SigningMethods()
+	return base
+}
+
+// JWKSHandler 发布JWKS
+func (i *TokenIssuer) JWKSHandler(req *restful.Request, resp *restful.Response) {
+	keySet, err := i.KeyRing.JWKS()
+	if err != nil {
+		_ = common.TokenErr(resp, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Cache-Control", "public, max-age=300")
+	common.ResponseSuccess(resp, keySet)
+}
+
+// OpenIDConfigurationHandler 发布discovery文档
+func (i *TokenIssuer) OpenIDConfigurationHandler(base datatypes.OpenIDConfiguration) restful.RouteFunction {
+	return func(req *restful.Request, resp *restful.Response) {
+		resp.Header().Set("Cache-Control", "public, max-age=300")
+		common.ResponseSuccess(resp, i.OpenIDConfiguration(base))
+	}
+}
@@ -0,0 +1,75 @@
+package eauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokenIssuer(t *testing.T) {
+	ctx := context.Background()
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, err := NewSigningKey("k1", privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &TokenIssuer{Issuer: "https://auth.example.com", KeyRing: NewKeyRing(key), RefreshTokens: NewRefreshTokenManager(NewMemoryRefreshTokenStore())}
+	authTime := time.Now().Add(-time.Hour).Unix()
+	claims := AccountClaims{Username: "admin", AppClientID: "app", AuthTime: authTime}
+	response, err := issuer.Issue(ctx, claims, nil, &RefreshToken{App: "app", AccountID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idClaims := IDTokenClaims{}
+	if _, err = jwt.ParseWithClaims(response.IDToken, &idClaims, issuer.KeyRing.Keyfunc); err != nil {
+		t.Fatal(err)
+	}
+	if idClaims.AuthTime != authTime || len(idClaims.Audience) != 1 || idClaims.Audience[0] != "app" {
+		t.Fatalf("auth_time: %d, aud: %v", idClaims.AuthTime, idClaims.Audience)
+	}
+
+	// 刷新后auth_time保持为登录时间
+	refreshed, err := issuer.Refresh(ctx, response.RefreshToken, func(ctx context.Context, refreshToken RefreshToken) (AccountClaims, *UserInfo, error) {
+		return AccountClaims{Username: "admin", AppClientID: refreshToken.App}, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idClaims = IDTokenClaims{}
+	if _, err = jwt.ParseWithClaims(refreshed.IDToken, &idClaims, issuer.KeyRing.Keyfunc); err != nil || idClaims.AuthTime != authTime {
+		t.Fatalf("refreshed auth_time: %d, err: %v", idClaims.AuthTime, err)
+	}
+	accessClaims, err := issuer.Verifier().Verify(refreshed.AccessToken)
+	if err != nil || accessClaims.AuthTime != authTime {
+		t.Fatalf("access token auth_time: %d, err: %v", accessClaims.AuthTime, err)
+	}
+
+	// 同一密钥签发的ID Token不能作为访问令牌使用
+	if _, err = issuer.Verifier().Verify(refreshed.IDToken); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("expected id token to be rejected, got: %v", err)
+	}
+	if _, err = issuer.Verifier("app").Verify(refreshed.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = issuer.Verifier("other").Verify(refreshed.AccessToken); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("expected audience mismatch, got: %v", err)
+	}
+
+	// AppClientID为空时访问令牌不包含aud，ID Token拒绝签发
+	tokenStr, _, err := issuer.IssueAccessToken(AccountClaims{Username: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accessClaims, err = issuer.Verifier().Verify(tokenStr); err != nil || accessClaims.Audience != nil {
+		t.Fatalf("aud: %v, err: %v", accessClaims.Audience, err)
+	}
+	if _, err = issuer.IssueIDToken(AccountClaims{Username: "admin"}, nil); !errors.Is(err, ErrIDTokenAudience) {
+		t.Fatalf("expected empty audience error, got: %v", err)
+	}
+}
@@ -0,0 +1,308 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/efucloud/common"
+	"github.com/efucloud/common/datatypes"
+	"github.com/efucloud/common/security"
+	"github.com/golang-jwt/jwt/v5"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultJwksCacheTTL           = time.Hour
+	DefaultJwksMinRefreshInterval = time.Minute
+	wellKnownOpenIDConfiguration  = "/.well-known/openid-configuration"
+)
+
+// SupportedSigningMethods RemoteKeySet支持的签名算法
+var SupportedSigningMethods = []string{
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodES256.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+}
+
+var ErrKeyNotFound = errors.New("verify key not found")
+
+// RemoteKeySet 根据OIDC提供商的discovery文档获取JWKS并缓存，缓存过期或者遇到未知kid时刷新，
+// 两次刷新之间至少间隔MinRefreshInterval，刷新失败时继续使用上一次获取的公钥，
+// 请求JWKS时不持有锁，使用缓存的校验不会被慢请求阻塞
+type RemoteKeySet struct {
+	CacheTTL           time.Duration
+	MinRefreshInterval time.Duration
+
+	issuer      string
+	jwksUri     string
+	client      *http.Client
+	mutex       sync.Mutex
+	keys        []security.JSONWebKey
+	expiresAt   time.Time
+	lastRefresh time.Time
+	fetching    *jwksFetch
+}
+
+// NewRemoteKeySet 配置了IssuerCA时使用该CA校验提供商证书，配置了Certificate以外的公钥需要由JWKS提供
+func NewRemoteKeySet(config datatypes.OidcConfig) (keySet *RemoteKeySet, err error) {
+	keySet = &RemoteKeySet{
+		CacheTTL:           DefaultJwksCacheTTL,
+		MinRefreshInterval: DefaultJwksMinRefreshInterval,
+		issuer:             strings.TrimSuffix(config.Issuer, "/"),
+	}
+	if keySet.client, err = newOidcHttpClient(config); err != nil {
+		return nil, err
+	}
+	return keySet, nil
+}
+
+// NewRemoteKeySetFromURI 直接使用jwksUri，不进行discovery
+func NewRemoteKeySetFromURI(jwksUri string, client *http.Client) *RemoteKeySet {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &RemoteKeySet{
+		CacheTTL:           DefaultJwksCacheTTL,
+		MinRefreshInterval: DefaultJwksMinRefreshInterval,
+		jwksUri:            jwksUri,
+		client:             client,
+	}
+}
+
+func newOidcHttpClient(config datatypes.OidcConfig) (*http.Client, error) {
+	if len(strings.TrimSpace(config.IssuerCA)) > 0 {
+		client, err := common.NewHTTPClientWithCA(config.IssuerCA, false)
+		if err != nil {
+			return nil, err
+		}
+		client.Timeout = 10 * time.Second
+		return client, nil
+	}
+	return &http.Client{Timeout: 10 * time.Second}, nil
+}
+
+// Discovery 获取issuer的openid-configuration
+func Discovery(ctx context.Context, client *http.Client, issuer string) (configuration datatypes.OpenIDConfiguration, err error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	if err = getJSON(ctx, client, issuer+wellKnownOpenIDConfiguration, &configuration, nil); err != nil {
+		return configuration, err
+	}
+	if strings.TrimSuffix(configuration.Issuer, "/") != issuer {
+		return configuration, fmt.Errorf("oidc issuer mismatch, expected: %s, got: %s", issuer, configuration.Issuer)
+	}
+	return configuration, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, address string, result interface{}, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request %s failed, err: %s", address, err.Error())
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("read %s response failed, err: %s", address, err.Error())
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("request %s failed, status: %d, body: %s", address, res.StatusCode, body)
+	}
+	if header != nil {
+		for k, v := range res.Header {
+			header[k] = v
+		}
+	}
+	if err = json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("decode %s response failed, err: %s", address, err.Error())
+	}
+	return nil
+}
+
+// Refresh 重新获取JWKS，不受MinRefreshInterval限制
+func (ks *RemoteKeySet) Refresh(ctx context.Context) error {
+	_, err := ks.refresh(ctx, true, true)
+	return err
+}
+
+// jwksFetch 正在进行的JWKS请求，并发的刷新等待同一个请求的结果
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// refresh 在锁外请求JWKS，只在替换公钥时加锁，避免慢请求阻塞使用缓存的校验；
+// 已有请求在进行时，wait为true则等待其结果，否则直接返回，force为false时受MinRefreshInterval限制，
+// refreshed表示是否进行或者等待了刷新
+func (ks *RemoteKeySet) refresh(ctx context.Context, force, wait bool) (refreshed bool, err error) {
+	ks.mutex.Lock()
+	if fetch := ks.fetching; fetch != nil {
+		ks.mutex.Unlock()
+		if !wait {
+			return false, nil
+		}
+		select {
+		case <-fetch.done:
+			return true, fetch.err
+		case <-ctx.Done():
+			return true, ctx.Err()
+		}
+	}
+	if !force && !ks.canRefresh() {
+		ks.mutex.Unlock()
+		return false, nil
+	}
+	fetch := &jwksFetch{done: make(chan struct{})}
+	ks.fetching = fetch
+	ks.lastRefresh = time.Now()
+	started, jwksUri := ks.lastRefresh, ks.jwksUri
+	ks.mutex.Unlock()
+
+	keys, maxAge, jwksUri, err := ks.fetch(ctx, jwksUri)
+	ks.mutex.Lock()
+	if err == nil {
+		ks.jwksUri = jwksUri
+		ks.keys = keys
+		ks.expiresAt = started.Add(maxAge)
+	}
+	ks.fetching = nil
+	ks.mutex.Unlock()
+	fetch.err = err
+	close(fetch.done)
+	return true, err
+}
+
+func (ks *RemoteKeySet) fetch(ctx context.Context, jwksUri string) (keys []security.JSONWebKey, maxAge time.Duration, _ string, err error) {
+	if len(jwksUri) == 0 {
+		configuration, err := Discovery(ctx, ks.client, ks.issuer)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		if len(configuration.JwksUri) == 0 {
+			return nil, 0, "", fmt.Errorf("oidc issuer %s has no jwks_uri", ks.issuer)
+		}
+		jwksUri = configuration.JwksUri
+	}
+	var keySet security.JSONWebKeySet
+	header := make(http.Header)
+	if err = getJSON(ctx, ks.client, jwksUri, &keySet, header); err != nil {
+		return nil, 0, "", err
+	}
+	return keySet.Keys, cacheMaxAge(header.Get("Cache-Control"), ks.CacheTTL), jwksUri, nil
+}
+
+func cacheMaxAge(cacheControl string, defaultTTL time.Duration) time.Duration {
+	for _, item := range strings.Split(cacheControl, ",") {
+		item = strings.TrimSpace(item)
+		if strings.HasPrefix(item, "max-age=") {
+			if seconds, err := strconv.Atoi(strings.TrimPrefix(item, "max-age=")); err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return defaultTTL
+}
+
+// Keyfunc 用于jwt解析，根据令牌头中的kid和alg选择公钥，获取JWKS时不能使用请求的ctx，建议使用KeyfuncContext
+func (ks *RemoteKeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	return ks.KeyfuncContext(context.Background())(token)
+}
+
+// KeyfuncContext 返回使用ctx获取JWKS的jwt.Keyfunc，可用作TokenVerifier.KeyfuncContext
+func (ks *RemoteKeySet) KeyfuncContext(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return ks.Key(ctx, kid, token.Method.Alg())
+	}
+}
+
+// Key 根据kid和alg获取公钥，kid为空时只有一个匹配的公钥才返回。
+// 缓存过期及未知kid触发的刷新都受MinRefreshInterval限制，刷新失败时使用已缓存的公钥
+func (ks *RemoteKeySet) Key(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	ks.mutex.Lock()
+	expired := time.Now().After(ks.expiresAt)
+	ks.mutex.Unlock()
+	var refreshErr error
+	// 缓存过期时已有刷新在进行则继续使用缓存的公钥
+	if expired {
+		_, refreshErr = ks.refresh(ctx, false, false)
+	}
+	key, err := ks.lookup(kid, alg)
+	if errors.Is(err, ErrKeyNotFound) {
+		var refreshed bool
+		if refreshed, refreshErr = ks.refresh(ctx, false, true); refreshed && refreshErr == nil {
+			key, err = ks.lookup(kid, alg)
+		}
+	}
+	if err != nil && refreshErr != nil {
+		return nil, fmt.Errorf("%w, refresh jwks failed, err: %s", err, refreshErr.Error())
+	}
+	return key, err
+}
+
+// canRefresh 调用时需要持有mutex
+func (ks *RemoteKeySet) canRefresh() bool {
+	return ks.lastRefresh.IsZero() || time.Since(ks.lastRefresh) >= ks.MinRefreshInterval
+}
+
+func (ks *RemoteKeySet) lookup(kid, alg string) (crypto.PublicKey, error) {
+	ks.mutex.Lock()
+	keys := ks.keys
+	ks.mutex.Unlock()
+	var matched []crypto.PublicKey
+	for _, item := range keys {
+		if (len(kid) > 0 && item.Kid != kid) || (len(item.Alg) > 0 && item.Alg != alg) || (len(item.Use) > 0 && item.Use != "sig") {
+			continue
+		}
+		key, err := item.PublicKey()
+		if err != nil || !keyMatchAlg(key, alg) {
+			continue
+		}
+		matched = append(matched, key)
+	}
+	if len(matched) == 1 || (len(kid) > 0 && len(matched) > 0) {
+		return matched[0], nil
+	}
+	return nil, fmt.Errorf("%w: kid: %s, alg: %s", ErrKeyNotFound, kid, alg)
+}
+
+func keyMatchAlg(key crypto.PublicKey, alg string) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(alg, "ES")
+	case ed25519.PublicKey:
+		return alg == jwt.SigningMethodEdDSA.Alg()
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package eauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"github.com/efucloud/common/datatypes"
+	"github.com/efucloud/common/security"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testIssuer struct {
+	server   *httptest.Server
+	mutex    sync.Mutex
+	keys     security.JSONWebKeySet
+	requests int32
+	failing  int32
+	blocked  chan struct{}
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	issuer := &testIssuer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc(wellKnownOpenIDConfiguration, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(datatypes.OpenIDConfiguration{
+			Issuer:  issuer.server.URL,
+			JwksUri: issuer.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&issuer.requests, 1)
+		if atomic.LoadInt32(&issuer.failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if issuer.blocked != nil {
+			<-issuer.blocked
+		}
+		issuer.mutex.Lock()
+		defer issuer.mutex.Unlock()
+		_ = json.NewEncoder(w).Encode(issuer.keys)
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (i *testIssuer) addKey(t *testing.T, publicKey crypto.PublicKey, kid, alg string) {
+	jwk, err := security.NewJSONWebKey(publicKey, kid, alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.keys.Keys = append(i.keys.Keys, jwk)
+}
+
+func (i *testIssuer) sign(t *testing.T, method jwt.SigningMethod, privateKey crypto.PrivateKey, kid string) string {
+	claims := AccountClaims{}
+	claims.Issuer = i.server.URL
+	claims.Username = "admin"
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	tokenStr, err := token.SignedString(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenStr
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	issuer := newTestIssuer(t)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	issuer.addKey(t, &rsaKey.PublicKey, "rsa", "RS256")
+	issuer.addKey(t, &ecKey.PublicKey, "ec", "ES256")
+
+	keySet, err := NewRemoteKeySet(datatypes.OidcConfig{Issuer: issuer.server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySet.MinRefreshInterval = 0
+	verifier := &TokenVerifier{Keyfunc: keySet.Keyfunc, Issuer: issuer.server.URL, Methods: SupportedSigningMethods}
+
+	for _, tokenStr := range []string{
+		issuer.sign(t, jwt.SigningMethodRS256, rsaKey, "rsa"),
+		issuer.sign(t, jwt.SigningMethodES256, ecKey, "ec"),
+	} {
+		if claims, err := verifier.Verify(tokenStr); err != nil || claims.Username != "admin" {
+			t.Fatalf("verify failed: %v", err)
+		}
+	}
+	if atomic.LoadInt32(&issuer.requests) != 1 {
+		t.Fatalf("expected keys to be cached, got %d requests", issuer.requests)
+	}
+
+	// 轮换后未知的kid触发刷新
+	issuer.addKey(t, edPublic, "ed", "EdDSA")
+	if _, err = verifier.Verify(issuer.sign(t, jwt.SigningMethodEdDSA, edPrivate, "ed")); err != nil {
+		t.Fatalf("verify rotated key failed: %v", err)
+	}
+	if atomic.LoadInt32(&issuer.requests) != 2 {
+		t.Fatalf("expected refresh on unknown kid, got %d requests", issuer.requests)
+	}
+
+	// kid与算法不匹配
+	if _, err = verifier.Verify(issuer.sign(t, jwt.SigningMethodRS256, rsaKey, "ec")); err == nil {
+		t.Fatal("expected key type mismatch to fail")
+	}
+
+	// 刷新间隔内不会重复请求
+	keySet.MinRefreshInterval = time.Hour
+	before := atomic.LoadInt32(&issuer.requests)
+	for i := 0; i < 3; i++ {
+		if _, err = verifier.Verify(issuer.sign(t, jwt.SigningMethodRS256, rsaKey, "unknown")); err == nil {
+			t.Fatal("expected unknown kid to fail")
+		}
+	}
+	if atomic.LoadInt32(&issuer.requests) != before {
+		t.Fatalf("expected refresh to be rate limited, got %d requests", issuer.requests-before)
+	}
+}
+
+func TestRemoteKeySetOutage(t *testing.T) {
+	issuer := newTestIssuer(t)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	issuer.addKey(t, &rsaKey.PublicKey, "rsa", "RS256")
+	keySet := NewRemoteKeySetFromURI(issuer.server.URL+"/keys", nil)
+	verifier := &TokenVerifier{KeyfuncContext: keySet.KeyfuncContext, Issuer: issuer.server.URL}
+	tokenStr := issuer.sign(t, jwt.SigningMethodRS256, rsaKey, "rsa")
+
+	// ctx取消时不会请求JWKS
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := verifier.VerifyContext(ctx, tokenStr); err == nil {
+		t.Fatal("expected canceled context to fail")
+	}
+	if atomic.LoadInt32(&issuer.requests) != 0 {
+		t.Fatalf("expected no request with canceled context, got %d", issuer.requests)
+	}
+	keySet.lastRefresh = time.Time{}
+	if _, err := verifier.VerifyContext(context.Background(), tokenStr); err != nil {
+		t.Fatal(err)
+	}
+
+	// 缓存过期后刷新失败，继续使用已缓存的公钥，并且刷新受MinRefreshInterval限制
+	atomic.StoreInt32(&issuer.failing, 1)
+	keySet.expiresAt = time.Now().Add(-time.Second)
+	keySet.lastRefresh = time.Now().Add(-2 * DefaultJwksMinRefreshInterval)
+	before := atomic.LoadInt32(&issuer.requests)
+	for i := 0; i < 3; i++ {
+		if _, err := verifier.Verify(tokenStr); err != nil {
+			t.Fatalf("expected stale key to be used, got: %v", err)
+		}
+	}
+	if requests := atomic.LoadInt32(&issuer.requests) - before; requests != 1 {
+		t.Fatalf("expected one refresh during outage, got %d", requests)
+	}
+}
+
+func TestRemoteKeySetSlowRefresh(t *testing.T) {
+	issuer := newTestIssuer(t)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	issuer.addKey(t, &rsaKey.PublicKey, "rsa", "RS256")
+	keySet := NewRemoteKeySetFromURI(issuer.server.URL+"/keys", nil)
+	keySet.MinRefreshInterval = 0
+	verifier := &TokenVerifier{KeyfuncContext: keySet.KeyfuncContext, Issuer: issuer.server.URL}
+	tokenStr := issuer.sign(t, jwt.SigningMethodRS256, rsaKey, "rsa")
+	if _, err := verifier.Verify(tokenStr); err != nil {
+		t.Fatal(err)
+	}
+
+	// 过期触发的刷新阻塞时，其它使用缓存的校验不需要等待
+	issuer.blocked = make(chan struct{})
+	keySet.mutex.Lock()
+	keySet.expiresAt = time.Now().Add(-time.Second)
+	keySet.mutex.Unlock()
+	refreshed := make(chan error)
+	go func() {
+		_, err := verifier.Verify(tokenStr)
+		refreshed <- err
+	}()
+	for atomic.LoadInt32(&issuer.requests) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := verifier.Verify(tokenStr)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("verify blocked by jwks refresh")
+	}
+	close(issuer.blocked)
+	if err := <-refreshed; err != nil {
+		t.Fatal(err)
+	}
+	if requests := atomic.LoadInt32(&issuer.requests); requests != 2 {
+		t.Fatalf("expected one refresh, got %d requests", requests-1)
+	}
+}
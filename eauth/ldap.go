@@ -0,0 +1,254 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eauth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const AuthProviderLDAP = "ldap"
+
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// Authenticator 使用用户名密码认证的提供商
+type Authenticator interface {
+	Authenticate(ctx context.Context, username, password string) (UserInfo, error)
+}
+
+// LDAPAttributes 用户属性与UserInfo的映射，为空时使用默认属性
+type LDAPAttributes struct {
+	Username string `json:"username" yaml:"username" description:"用户名属性，默认uid"`
+	Email    string `json:"email" yaml:"email" description:"邮箱属性，默认mail"`
+	Phone    string `json:"phone" yaml:"phone" description:"手机属性，默认telephoneNumber"`
+	Nickname string `json:"nickname" yaml:"nickname" description:"昵称属性，默认cn"`
+	Groups   string `json:"groups" yaml:"groups" description:"用户所属组属性，默认memberOf"`
+}
+
+// LDAPConfig LDAP认证配置，URL为ldap://或ldaps://地址
+type LDAPConfig struct {
+	URL                string         `json:"url" yaml:"url" description:"服务地址，如ldaps://ldap.example.com:636"`
+	StartTLS           bool           `json:"startTLS" yaml:"startTLS" description:"ldap://连接后是否使用StartTLS"`
+	CA                 string         `json:"ca" yaml:"ca" description:"服务端证书的CA，为空时使用系统CA"`
+	InsecureSkipVerify bool           `json:"insecureSkipVerify" yaml:"insecureSkipVerify" description:"是否跳过证书校验"`
+	BindDN             string         `json:"bindDN" yaml:"bindDN" description:"用于查询用户的账号"`
+	BindPassword       string         `json:"bindPassword" yaml:"bindPassword" description:"查询账号的密码"`
+	BaseDN             string         `json:"baseDN" yaml:"baseDN" description:"用户查询的BaseDN"`
+	UserFilter         string         `json:"userFilter" yaml:"userFilter" description:"用户查询条件，{username}会被替换为转义后的用户名，默认(uid={username})"`
+	Attributes         LDAPAttributes `json:"attributes" yaml:"attributes" description:"属性映射"`
+	GroupBaseDN        string         `json:"groupBaseDN" yaml:"groupBaseDN" description:"组查询的BaseDN，为空时只使用用户的组属性"`
+	GroupFilter        string         `json:"groupFilter" yaml:"groupFilter" description:"组查询条件，{dn}、{username}会被替换，默认(member={dn})"`
+	GroupNameAttribute string         `json:"groupNameAttribute" yaml:"groupNameAttribute" description:"组名属性，默认cn"`
+	Timeout            time.Duration  `json:"timeout" yaml:"timeout" description:"连接超时"`
+}
+
+// LDAPConn LDAP连接，*ldap.Conn实现了该接口
+type LDAPConn interface {
+	Bind(username, password string) error
+	Search(request *ldap.SearchRequest) (*ldap.SearchResult, error)
+	StartTLS(config *tls.Config) error
+	Close() error
+}
+
+// LDAPAuthenticator LDAP认证：使用BindDN查询用户，再以用户DN及密码绑定校验密码
+type LDAPAuthenticator struct {
+	Config LDAPConfig
+	// Dial 建立连接，为空时使用ldap.DialURL，测试时可以替换
+	Dial func(ctx context.Context, config LDAPConfig, tlsConfig *tls.Config) (LDAPConn, error)
+}
+
+func NewLDAPAuthenticator(config LDAPConfig) *LDAPAuthenticator {
+	return &LDAPAuthenticator{Config: config}
+}
+
+func defaultString(value, defaultValue string) string {
+	if len(value) > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func (a *LDAPAuthenticator) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: a.Config.InsecureSkipVerify, MinVersion: tls.VersionTLS12}
+	if u, err := url.Parse(a.Config.URL); err == nil {
+		config.ServerName = u.Hostname()
+	}
+	if len(strings.TrimSpace(a.Config.CA)) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(a.Config.CA)) {
+			return nil, errors.New("ldap ca is invalid")
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+func dialLDAP(ctx context.Context, config LDAPConfig, tlsConfig *tls.Config) (LDAPConn, error) {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	conn, err := ldap.DialURL(config.URL, ldap.DialWithTLSConfig(tlsConfig), ldap.DialWithDialer(&net.Dialer{Timeout: timeout}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(timeout)
+	return conn, nil
+}
+
+func (a *LDAPAuthenticator) connect(ctx context.Context) (LDAPConn, error) {
+	tlsConfig, err := a.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	dial := a.Dial
+	if dial == nil {
+		dial = dialLDAP
+	}
+	conn, err := dial(ctx, a.Config, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("connect ldap %s failed, err: %s", a.Config.URL, err.Error())
+	}
+	if a.Config.StartTLS && !strings.HasPrefix(a.Config.URL, "ldaps://") {
+		if err = conn.StartTLS(tlsConfig); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("ldap start tls failed, err: %s", err.Error())
+		}
+	}
+	return conn, nil
+}
+
+func (a *LDAPAuthenticator) bindService(conn LDAPConn) error {
+	if len(a.Config.BindDN) == 0 {
+		return nil
+	}
+	if err := conn.Bind(a.Config.BindDN, a.Config.BindPassword); err != nil {
+		return fmt.Errorf("ldap bind %s failed, err: %s", a.Config.BindDN, err.Error())
+	}
+	return nil
+}
+
+// Authenticate 校验用户名密码并返回用户信息，用户不存在或者密码错误都返回ErrInvalidCredentials
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password string) (user UserInfo, err error) {
+	// 空密码会被LDAP视为匿名绑定而成功
+	if len(username) == 0 || len(password) == 0 {
+		return user, ErrInvalidCredentials
+	}
+	conn, err := a.connect(ctx)
+	if err != nil {
+		return user, err
+	}
+	defer conn.Close()
+	if err = a.bindService(conn); err != nil {
+		return user, err
+	}
+	attributes := a.attributes()
+	filter := strings.ReplaceAll(defaultString(a.Config.UserFilter, "(uid={username})"), "{username}", ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(a.Config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		filter, []string{attributes.Username, attributes.Email, attributes.Phone, attributes.Nickname, attributes.Groups}, nil))
+	if err != nil {
+		return user, fmt.Errorf("ldap search user failed, err: %s", err.Error())
+	}
+	if len(result.Entries) != 1 {
+		return user, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+	if err = conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return user, ErrInvalidCredentials
+		}
+		return user, fmt.Errorf("ldap bind user failed, err: %s", err.Error())
+	}
+	user = UserInfo{
+		Subject:      entry.DN,
+		Username:     defaultString(entry.GetAttributeValue(attributes.Username), username),
+		Email:        entry.GetAttributeValue(attributes.Email),
+		Phone:        entry.GetAttributeValue(attributes.Phone),
+		Nickname:     entry.GetAttributeValue(attributes.Nickname),
+		AuthProvider: AuthProviderLDAP,
+		Enable:       true,
+	}
+	for _, group := range entry.GetAttributeValues(attributes.Groups) {
+		user.Groups = appendGroup(user.Groups, groupName(group))
+	}
+	if len(a.Config.GroupBaseDN) > 0 {
+		// 用户绑定后可能没有查询组的权限，重新使用查询账号绑定
+		if err = a.bindService(conn); err != nil {
+			return user, err
+		}
+		groups, err := a.searchGroups(conn, entry.DN, user.Username)
+		if err != nil {
+			return user, err
+		}
+		for _, group := range groups {
+			user.Groups = appendGroup(user.Groups, group)
+		}
+	}
+	return user, nil
+}
+
+func (a *LDAPAuthenticator) attributes() LDAPAttributes {
+	return LDAPAttributes{
+		Username: defaultString(a.Config.Attributes.Username, "uid"),
+		Email:    defaultString(a.Config.Attributes.Email, "mail"),
+		Phone:    defaultString(a.Config.Attributes.Phone, "telephoneNumber"),
+		Nickname: defaultString(a.Config.Attributes.Nickname, "cn"),
+		Groups:   defaultString(a.Config.Attributes.Groups, "memberOf"),
+	}
+}
+
+func (a *LDAPAuthenticator) searchGroups(conn LDAPConn, dn, username string) (groups []string, err error) {
+	nameAttribute := defaultString(a.Config.GroupNameAttribute, "cn")
+	filter := defaultString(a.Config.GroupFilter, "(member={dn})")
+	filter = strings.ReplaceAll(filter, "{dn}", ldap.EscapeFilter(dn))
+	filter = strings.ReplaceAll(filter, "{username}", ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(a.Config.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter, []string{nameAttribute}, nil))
+	if err != nil {
+		return nil, fmt.Errorf("ldap search groups failed, err: %s", err.Error())
+	}
+	for _, entry := range result.Entries {
+		groups = append(groups, defaultString(entry.GetAttributeValue(nameAttribute), groupName(entry.DN)))
+	}
+	return groups, nil
+}
+
+// groupName 组属性为DN时取第一个RDN的值，如cn=dev,ou=groups,dc=example,dc=com返回dev
+func groupName(group string) string {
+	dn, err := ldap.ParseDN(group)
+	if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+		return group
+	}
+	return dn.RDNs[0].Attributes[0].Value
+}
+
+func appendGroup(groups []string, group string) []string {
+	for _, item := range groups {
+		if item == group {
+			return groups
+		}
+	}
+	return append(groups, group)
+}
@@ -0,0 +1,101 @@
+package eauth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/go-ldap/ldap/v3"
+	"strings"
+	"testing"
+)
+
+// fakeLDAP 进程内的LDAP服务替身，只支持(attr=value)形式的查询条件
+type fakeLDAP struct {
+	entries   map[string]map[string][]string
+	passwords map[string]string
+	bound     string
+	startTLS  bool
+}
+
+func (f *fakeLDAP) Bind(username, password string) error {
+	if expected, exist := f.passwords[username]; !exist || expected != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	f.bound = username
+	return nil
+}
+
+func (f *fakeLDAP) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if len(f.bound) == 0 {
+		return nil, ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("bind required"))
+	}
+	items := strings.SplitN(strings.Trim(request.Filter, "()"), "=", 2)
+	value := strings.NewReplacer(`\28`, "(", `\29`, ")", `\2a`, "*", `\5c`, `\`).Replace(items[1])
+	result := &ldap.SearchResult{}
+	for dn, attributes := range f.entries {
+		if !strings.HasSuffix(dn, request.BaseDN) {
+			continue
+		}
+		for _, item := range attributes[items[0]] {
+			if item == value {
+				result.Entries = append(result.Entries, ldap.NewEntry(dn, attributes))
+			}
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeLDAP) StartTLS(config *tls.Config) error {
+	f.startTLS = true
+	return nil
+}
+
+func (f *fakeLDAP) Close() error {
+	return nil
+}
+
+func TestLDAPAuthenticator(t *testing.T) {
+	server := &fakeLDAP{
+		entries: map[string]map[string][]string{
+			"uid=alice,ou=people,dc=example,dc=com": {
+				"uid": {"alice"}, "mail": {"alice@example.com"}, "cn": {"Alice"},
+				"memberOf": {"cn=dev,ou=groups,dc=example,dc=com"},
+			},
+			"cn=ops,ou=groups,dc=example,dc=com": {"cn": {"ops"}, "member": {"uid=alice,ou=people,dc=example,dc=com"}},
+			"cn=dev,ou=groups,dc=example,dc=com": {"cn": {"dev"}, "member": {"uid=alice,ou=people,dc=example,dc=com"}},
+		},
+		passwords: map[string]string{
+			"cn=admin,dc=example,dc=com":            "admin",
+			"uid=alice,ou=people,dc=example,dc=com": "secret",
+		},
+	}
+	authenticator := NewLDAPAuthenticator(LDAPConfig{
+		URL:          "ldap://ldap.example.com:389",
+		StartTLS:     true,
+		BindDN:       "cn=admin,dc=example,dc=com",
+		BindPassword: "admin",
+		BaseDN:       "ou=people,dc=example,dc=com",
+		GroupBaseDN:  "ou=groups,dc=example,dc=com",
+	})
+	authenticator.Dial = func(ctx context.Context, config LDAPConfig, tlsConfig *tls.Config) (LDAPConn, error) {
+		if tlsConfig.ServerName != "ldap.example.com" {
+			t.Fatalf("unexpected tls server name: %s", tlsConfig.ServerName)
+		}
+		server.bound = ""
+		return server, nil
+	}
+
+	user, err := authenticator.Authenticate(context.Background(), "alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !server.startTLS || user.Username != "alice" || user.Email != "alice@example.com" || user.Nickname != "Alice" ||
+		user.AuthProvider != AuthProviderLDAP || len(user.Groups) != 2 {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	for _, c := range []struct{ username, password string }{{"alice", "wrong"}, {"alice", ""}, {"bob", "secret"}, {"*", "secret"}} {
+		if _, err = authenticator.Authenticate(context.Background(), c.username, c.password); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("%s/%s expected invalid credentials, got: %v", c.username, c.password, err)
+		}
+	}
+}
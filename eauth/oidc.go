@@ -0,0 +1,346 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/efucloud/common/datatypes"
+	"github.com/efucloud/common/security"
+	"github.com/golang-jwt/jwt/v5"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultUsernameClaim = "preferred_username"
+	DefaultGroupsClaim   = "groups"
+	PKCEMethodS256       = "S256"
+)
+
+var (
+	DefaultOidcScopes = []string{"openid", "profile", "email"}
+	ErrNonceMismatch  = errors.New("nonce mismatch")
+)
+
+// OidcClient OIDC依赖方，根据OidcConfig完成授权码流程。
+// OidcConfig中未配置的端点从Issuer的discovery文档获取，配置了Certificate时使用该公钥校验ID Token，否则使用JWKS
+type OidcClient struct {
+	Config   datatypes.OidcConfig
+	Provider datatypes.OpenIDConfiguration
+	Leeway   time.Duration
+
+	client  *http.Client
+	keyfunc func(ctx context.Context) jwt.Keyfunc
+}
+
+// NewOidcClient 创建依赖方，需要discovery时会请求Issuer
+func NewOidcClient(ctx context.Context, config datatypes.OidcConfig) (oidcClient *OidcClient, err error) {
+	oidcClient = &OidcClient{Config: config}
+	if oidcClient.client, err = newOidcHttpClient(config); err != nil {
+		return nil, err
+	}
+	needDiscovery := len(config.TokenEndpoint) == 0 || len(config.AuthorizationEndpoint) == 0 || len(config.Certificate) == 0
+	if needDiscovery {
+		if oidcClient.Provider, err = Discovery(ctx, oidcClient.client, config.Issuer); err != nil {
+			return nil, err
+		}
+	}
+	if len(config.AuthorizationEndpoint) > 0 {
+		oidcClient.Provider.AuthorizationEndpoint = config.AuthorizationEndpoint
+	}
+	if len(config.TokenEndpoint) > 0 {
+		oidcClient.Provider.TokenEndpoint = config.TokenEndpoint
+	}
+	if len(config.UserinfoEndPoint) > 0 {
+		oidcClient.Provider.UserinfoEndpoint = config.UserinfoEndPoint
+	}
+	if len(config.Certificate) > 0 {
+		publicKey, err := parsePublicKeyPEM(config.Certificate)
+		if err != nil {
+			return nil, err
+		}
+		oidcClient.keyfunc = func(ctx context.Context) jwt.Keyfunc {
+			return func(token *jwt.Token) (interface{}, error) {
+				return publicKey, nil
+			}
+		}
+	} else {
+		if len(oidcClient.Provider.JwksUri) == 0 {
+			return nil, fmt.Errorf("oidc issuer %s has no jwks_uri", config.Issuer)
+		}
+		oidcClient.keyfunc = NewRemoteKeySetFromURI(oidcClient.Provider.JwksUri, oidcClient.client).KeyfuncContext
+	}
+	return oidcClient, nil
+}
+
+// parsePublicKeyPEM 支持证书、PKIX及PKCS#1格式的公钥
+func parsePublicKeyPEM(data string) (crypto.PublicKey, error) {
+	publicKey, err := security.ParsePublicKeyPEM([]byte(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse oidc certificate failed, err: %s", err.Error())
+	}
+	return publicKey, nil
+}
+
+// NewPKCEVerifier 生成RFC 7636 code_verifier
+func NewPKCEVerifier() string {
+	buff := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, buff); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buff)
+}
+
+// PKCEChallengeS256 根据code_verifier计算S256 code_challenge
+func PKCEChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL 生成授权地址，codeChallenge为空时不使用PKCE
+func (c *OidcClient) AuthCodeURL(state, nonce, codeChallenge string, extra url.Values) string {
+	scopes := c.Config.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultOidcScopes
+	}
+	query := url.Values{}
+	for k, v := range extra {
+		query[k] = v
+	}
+	query.Set("response_type", "code")
+	query.Set("client_id", c.Config.ClientID)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state)
+	if len(c.Config.RedirectURI) > 0 {
+		query.Set("redirect_uri", c.Config.RedirectURI)
+	}
+	if len(nonce) > 0 {
+		query.Set("nonce", nonce)
+	}
+	if len(codeChallenge) > 0 {
+		query.Set("code_challenge", codeChallenge)
+		query.Set("code_challenge_method", PKCEMethodS256)
+	}
+	endpoint := c.Provider.AuthorizationEndpoint
+	if strings.Contains(endpoint, "?") {
+		return endpoint + "&" + query.Encode()
+	}
+	return endpoint + "?" + query.Encode()
+}
+
+// Exchange 使用授权码换取令牌，配置了ClientSecret时使用client_secret_basic认证
+func (c *OidcClient) Exchange(ctx context.Context, code, codeVerifier string) (token TokenResponse, err error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("client_id", c.Config.ClientID)
+	if len(c.Config.RedirectURI) > 0 {
+		form.Set("redirect_uri", c.Config.RedirectURI)
+	}
+	if len(codeVerifier) > 0 {
+		form.Set("code_verifier", codeVerifier)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return token, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if len(c.Config.ClientSecret) > 0 {
+		req.SetBasicAuth(url.QueryEscape(c.Config.ClientID), url.QueryEscape(c.Config.ClientSecret))
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return token, fmt.Errorf("request %s failed, err: %s", c.Provider.TokenEndpoint, err.Error())
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return token, err
+	}
+	if res.StatusCode != http.StatusOK {
+		var tokenErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		_ = json.Unmarshal(body, &tokenErr)
+		return token, fmt.Errorf("exchange code failed, status: %d, error: %s, description: %s", res.StatusCode, tokenErr.Error, tokenErr.Description)
+	}
+	if err = json.Unmarshal(body, &token); err != nil {
+		return token, fmt.Errorf("decode token response failed, err: %s", err.Error())
+	}
+	if len(token.AccessToken) == 0 {
+		return token, errors.New("token response has no access_token")
+	}
+	return token, nil
+}
+
+// VerifyIDToken 校验ID Token的签名、iss、aud、exp，nonce不为空时校验nonce
+func (c *OidcClient) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (claims jwt.MapClaims, err error) {
+	claims = jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, c.keyfunc(ctx),
+		jwt.WithValidMethods(SupportedSigningMethods),
+		jwt.WithIssuer(c.Config.Issuer),
+		jwt.WithAudience(c.Config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(c.Leeway))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTokenInvalid, err.Error())
+	}
+	if len(nonce) > 0 {
+		if value, _ := claims["nonce"].(string); value != nonce {
+			return nil, ErrNonceMismatch
+		}
+	}
+	return claims, nil
+}
+
+// UserInfo 获取userinfo端点的用户信息
+func (c *OidcClient) UserInfo(ctx context.Context, accessToken string) (claims map[string]interface{}, err error) {
+	if len(c.Provider.UserinfoEndpoint) == 0 {
+		return nil, errors.New("oidc userinfo endpoint not configured")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Provider.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", TokenTypeBearer+" "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request %s failed, err: %s", c.Provider.UserinfoEndpoint, err.Error())
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request %s failed, status: %d", c.Provider.UserinfoEndpoint, res.StatusCode)
+	}
+	if err = json.Unmarshal(body, &claims); err != nil {
+		return nil, fmt.Errorf("decode userinfo failed, err: %s", err.Error())
+	}
+	return claims, nil
+}
+
+// Authenticate 完成授权码流程：换取令牌、校验ID Token、获取userinfo并转换为UserInfo，
+// userinfo中的sub必须与ID Token一致
+func (c *OidcClient) Authenticate(ctx context.Context, code, codeVerifier, nonce string) (user UserInfo, token TokenResponse, err error) {
+	if token, err = c.Exchange(ctx, code, codeVerifier); err != nil {
+		return user, token, err
+	}
+	if len(token.IDToken) == 0 {
+		return user, token, errors.New("token response has no id_token")
+	}
+	claims, err := c.VerifyIDToken(ctx, token.IDToken, nonce)
+	if err != nil {
+		return user, token, err
+	}
+	if len(c.Provider.UserinfoEndpoint) > 0 {
+		info, err := c.UserInfo(ctx, token.AccessToken)
+		if err != nil {
+			return user, token, err
+		}
+		if info["sub"] != claims["sub"] {
+			return user, token, errors.New("userinfo subject mismatch")
+		}
+		for k, v := range info {
+			claims[k] = v
+		}
+	}
+	return c.MapUserInfo(claims), token, nil
+}
+
+// MapUserInfo 根据UsernameClaim、GroupsClaim将claims转换为UserInfo，claim支持a.b形式的嵌套路径
+func (c *OidcClient) MapUserInfo(claims map[string]interface{}) (user UserInfo) {
+	usernameClaim, groupsClaim := c.Config.UsernameClaim, c.Config.GroupsClaim
+	if len(usernameClaim) == 0 {
+		usernameClaim = DefaultUsernameClaim
+	}
+	if len(groupsClaim) == 0 {
+		groupsClaim = DefaultGroupsClaim
+	}
+	user.Subject = claimString(claims, "sub")
+	user.Username = claimString(claims, usernameClaim)
+	if len(user.Username) == 0 {
+		user.Username = user.Subject
+	}
+	user.Groups = claimStrings(claims, groupsClaim)
+	user.Email = claimString(claims, "email")
+	user.EmailVerified, _ = claims["email_verified"].(bool)
+	user.Nickname = claimString(claims, "nickname")
+	if len(user.Nickname) == 0 {
+		user.Nickname = claimString(claims, "name")
+	}
+	user.Phone = claimString(claims, "phone_number")
+	user.Profile = claimString(claims, "profile")
+	user.AuthProvider = c.Config.Issuer
+	return user
+}
+
+func claimValue(claims map[string]interface{}, path string) interface{} {
+	if value, exist := claims[path]; exist {
+		return value
+	}
+	var current interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[key]
+	}
+	return current
+}
+
+func claimString(claims map[string]interface{}, path string) string {
+	switch value := claimValue(claims, path).(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return ""
+}
+
+func claimStrings(claims map[string]interface{}, path string) (results []string) {
+	switch value := claimValue(claims, path).(type) {
+	case string:
+		return strings.Fields(strings.ReplaceAll(value, ",", " "))
+	case []interface{}:
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				results = append(results, s)
+			}
+		}
+	case []string:
+		return value
+	}
+	return results
+}
@@ -0,0 +1,81 @@
+package eauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"github.com/efucloud/common/datatypes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestOidcClient(t *testing.T) {
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	signingKey, err := NewSigningKey("k1", privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const clientID, secret, code, verifier, nonce = "client", "secret", "code", "verifier-0123456789-0123456789-0123456789", "nonce"
+	var server *httptest.Server
+	issuer := &TokenIssuer{KeyRing: NewKeyRing(signingKey)}
+	mux := http.NewServeMux()
+	mux.HandleFunc(wellKnownOpenIDConfiguration, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(issuer.OpenIDConfiguration(datatypes.OpenIDConfiguration{
+			TokenEndpoint:    server.URL + "/token",
+			UserinfoEndpoint: server.URL + "/userinfo",
+		}))
+	})
+	mux.HandleFunc(JwksPath, func(w http.ResponseWriter, r *http.Request) {
+		keySet, _ := issuer.KeyRing.JWKS()
+		_ = json.NewEncoder(w).Encode(keySet)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, pass, _ := r.BasicAuth()
+		if id != clientID || pass != secret || r.PostFormValue("code") != code ||
+			PKCEChallengeS256(r.PostFormValue("code_verifier")) != PKCEChallengeS256(verifier) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		token, _ := issuer.Issue(r.Context(), AccountClaims{Username: "admin", AppClientID: clientID, Nonce: nonce}, nil, nil)
+		_ = json.NewEncoder(w).Encode(token)
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"sub":"admin","email":"admin@efucloud.com","profile":{"login":"root"},"roles":["dev","ops"]}`))
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+	issuer.Issuer = server.URL
+
+	client, err := NewOidcClient(context.Background(), datatypes.OidcConfig{
+		Issuer:        server.URL,
+		ClientID:      clientID,
+		ClientSecret:  secret,
+		RedirectURI:   "https://app/callback",
+		UsernameClaim: "profile.login",
+		GroupsClaim:   "roles",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, _ := url.Parse(client.AuthCodeURL("state", nonce, PKCEChallengeS256(verifier), nil))
+	if q := authURL.Query(); q.Get("code_challenge_method") != PKCEMethodS256 || q.Get("nonce") != nonce || q.Get("scope") != "openid profile email" {
+		t.Fatalf("unexpected auth url: %s", authURL)
+	}
+	if _, _, err = client.Authenticate(context.Background(), code, "wrong", nonce); err == nil {
+		t.Fatal("expected wrong code verifier to fail")
+	}
+	if _, _, err = client.Authenticate(context.Background(), code, verifier, "other"); err != ErrNonceMismatch {
+		t.Fatalf("expected nonce mismatch, got: %v", err)
+	}
+	user, _, err := client.Authenticate(context.Background(), code, verifier, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Subject != "admin" || user.Username != "root" || user.Email != "admin@efucloud.com" || len(user.Groups) != 2 {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+}
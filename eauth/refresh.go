@@ -0,0 +1,241 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/efucloud/common"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRefreshTokenAbsoluteLifetime = 30 * 24 * time.Hour
+	DefaultRefreshTokenIdleLifetime     = 7 * 24 * time.Hour
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token invalid")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	// ErrRefreshTokenReused 已轮换的刷新令牌被再次使用，整个family已被撤销
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// RefreshTokenRecord 刷新令牌的保存记录，ID为令牌的SHA-256摘要
+type RefreshTokenRecord struct {
+	RefreshToken
+	FamilyCreatedAt time.Time `json:"familyCreatedAt"`
+	CreatedAt       time.Time `json:"createdAt"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+	Rotated         bool      `json:"rotated"`
+	Revoked         bool      `json:"revoked"`
+}
+
+// RefreshTokenStore 刷新令牌存储，已轮换的记录需要保留到过期以便发现重用
+type RefreshTokenStore interface {
+	Save(ctx context.Context, record RefreshTokenRecord) error
+	// Get 记录不存在时返回ErrRefreshTokenInvalid
+	Get(ctx context.Context, id string) (RefreshTokenRecord, error)
+	// MarkRotated 原子地将记录标记为已轮换，记录已轮换或者已撤销时返回false
+	MarkRotated(ctx context.Context, id string) (bool, error)
+	RevokeFamily(ctx context.Context, family string) error
+	// RevokeAccount 撤销账号的刷新令牌，app为空时撤销所有应用
+	RevokeAccount(ctx context.Context, accountID uint, app string) error
+	RevokeApp(ctx context.Context, app string) error
+}
+
+// RefreshTokenManager 签发不透明的刷新令牌，每个令牌只能使用一次，
+// 有效期不超过family创建后的AbsoluteLifetime，且IdleLifetime内未使用即过期
+type RefreshTokenManager struct {
+	Store            RefreshTokenStore
+	AbsoluteLifetime time.Duration
+	IdleLifetime     time.Duration
+}
+
+func NewRefreshTokenManager(store RefreshTokenStore) *RefreshTokenManager {
+	return &RefreshTokenManager{
+		Store:            store,
+		AbsoluteLifetime: DefaultRefreshTokenAbsoluteLifetime,
+		IdleLifetime:     DefaultRefreshTokenIdleLifetime,
+	}
+}
+
+// RefreshTokenID 令牌的摘要，存储中只保存摘要
+func RefreshTokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create 签发新的刷新令牌，开始新的family
+func (m *RefreshTokenManager) Create(ctx context.Context, refreshToken RefreshToken) (token string, record RefreshTokenRecord, err error) {
+	refreshToken.Family = common.NewID()
+	return m.create(ctx, refreshToken, time.Now())
+}
+
+func (m *RefreshTokenManager) create(ctx context.Context, refreshToken RefreshToken, familyCreatedAt time.Time) (token string, record RefreshTokenRecord, err error) {
+	now := time.Now()
+	token = common.NewSecureID(32)
+	refreshToken.ID = RefreshTokenID(token)
+	record = RefreshTokenRecord{
+		RefreshToken:    refreshToken,
+		FamilyCreatedAt: familyCreatedAt,
+		CreatedAt:       now,
+		ExpiresAt:       familyCreatedAt.Add(m.AbsoluteLifetime),
+	}
+	if idle := now.Add(m.IdleLifetime); m.IdleLifetime > 0 && idle.Before(record.ExpiresAt) {
+		record.ExpiresAt = idle
+	}
+	record.ExpiresIn = int64(record.ExpiresAt.Sub(now).Seconds())
+	if err = m.Store.Save(ctx, record); err != nil {
+		return "", record, err
+	}
+	return token, record, nil
+}
+
+// Rotate 使用刷新令牌换取新的刷新令牌，已轮换的令牌再次使用时撤销整个family并返回ErrRefreshTokenReused
+func (m *RefreshTokenManager) Rotate(ctx context.Context, token string) (newToken string, refreshToken RefreshToken, err error) {
+	record, err := m.Store.Get(ctx, RefreshTokenID(token))
+	if err != nil {
+		return "", refreshToken, err
+	}
+	if record.Revoked {
+		return "", refreshToken, ErrRefreshTokenInvalid
+	}
+	if record.Rotated {
+		return "", refreshToken, m.reused(ctx, record)
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return "", refreshToken, ErrRefreshTokenExpired
+	}
+	rotated, err := m.Store.MarkRotated(ctx, record.ID)
+	if err != nil {
+		return "", refreshToken, err
+	}
+	if !rotated {
+		// 并发使用同一个令牌
+		return "", refreshToken, m.reused(ctx, record)
+	}
+	newToken, record, err = m.create(ctx, record.RefreshToken, record.FamilyCreatedAt)
+	return newToken, record.RefreshToken, err
+}
+
+func (m *RefreshTokenManager) reused(ctx context.Context, record RefreshTokenRecord) error {
+	if err := m.Store.RevokeFamily(ctx, record.Family); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// Revoke 撤销令牌所在的family，用于退出登录
+func (m *RefreshTokenManager) Revoke(ctx context.Context, token string) error {
+	record, err := m.Store.Get(ctx, RefreshTokenID(token))
+	if err != nil {
+		return err
+	}
+	return m.Store.RevokeFamily(ctx, record.Family)
+}
+
+// RevokeAccount 撤销账号的刷新令牌，app为空时撤销所有应用
+func (m *RefreshTokenManager) RevokeAccount(ctx context.Context, accountID uint, app string) error {
+	return m.Store.RevokeAccount(ctx, accountID, app)
+}
+
+// RevokeApp 撤销应用的所有刷新令牌
+func (m *RefreshTokenManager) RevokeApp(ctx context.Context, app string) error {
+	return m.Store.RevokeApp(ctx, app)
+}
+
+// MemoryRefreshTokenStore 内存存储，用于测试及单实例部署
+type MemoryRefreshTokenStore struct {
+	mutex   sync.Mutex
+	records map[string]*RefreshTokenRecord
+}
+
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{records: make(map[string]*RefreshTokenRecord)}
+}
+
+func (s *MemoryRefreshTokenStore) Save(ctx context.Context, record RefreshTokenRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	for id, item := range s.records {
+		if now.After(item.ExpiresAt) {
+			delete(s.records, id)
+		}
+	}
+	s.records[record.ID] = &record
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) Get(ctx context.Context, id string) (RefreshTokenRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	record, exist := s.records[id]
+	if !exist {
+		return RefreshTokenRecord{}, ErrRefreshTokenInvalid
+	}
+	return *record, nil
+}
+
+func (s *MemoryRefreshTokenStore) MarkRotated(ctx context.Context, id string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	record, exist := s.records[id]
+	if !exist {
+		return false, ErrRefreshTokenInvalid
+	}
+	if record.Rotated || record.Revoked {
+		return false, nil
+	}
+	record.Rotated = true
+	return true, nil
+}
+
+func (s *MemoryRefreshTokenStore) revoke(match func(record *RefreshTokenRecord) bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, record := range s.records {
+		if match(record) {
+			record.Revoked = true
+		}
+	}
+}
+
+func (s *MemoryRefreshTokenStore) RevokeFamily(ctx context.Context, family string) error {
+	s.revoke(func(record *RefreshTokenRecord) bool {
+		return record.Family == family
+	})
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) RevokeAccount(ctx context.Context, accountID uint, app string) error {
+	s.revoke(func(record *RefreshTokenRecord) bool {
+		return record.AccountID == accountID && (len(app) == 0 || record.App == app)
+	})
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) RevokeApp(ctx context.Context, app string) error {
+	s.revoke(func(record *RefreshTokenRecord) bool {
+		return record.App == app
+	})
+	return nil
+}
@@ -0,0 +1,53 @@
+package eauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ctx := context.Background()
+	manager := NewRefreshTokenManager(NewMemoryRefreshTokenStore())
+	first, _, err := manager.Create(ctx, RefreshToken{App: "app", AccountID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, refreshToken, err := manager.Rotate(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshToken.AccountID != 1 || refreshToken.App != "app" || refreshToken.ID != RefreshTokenID(second) {
+		t.Fatalf("unexpected rotated token: %+v", refreshToken)
+	}
+	// 重用已轮换的令牌会撤销整个family
+	if _, _, err = manager.Rotate(ctx, first); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected reuse detected, got: %v", err)
+	}
+	if _, _, err = manager.Rotate(ctx, second); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Fatalf("expected family revoked, got: %v", err)
+	}
+	if _, _, err = manager.Rotate(ctx, "unknown"); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Fatalf("expected unknown token invalid, got: %v", err)
+	}
+
+	other, _, _ := manager.Create(ctx, RefreshToken{App: "app", AccountID: 2})
+	kept, _, _ := manager.Create(ctx, RefreshToken{App: "other", AccountID: 2})
+	if err = manager.RevokeAccount(ctx, 2, "app"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = manager.Rotate(ctx, other); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Fatalf("expected account token revoked, got: %v", err)
+	}
+	if _, _, err = manager.Rotate(ctx, kept); err != nil {
+		t.Fatalf("expected token of other app kept, got: %v", err)
+	}
+
+	manager.IdleLifetime = time.Millisecond
+	idle, _, _ := manager.Create(ctx, RefreshToken{App: "app", AccountID: 3})
+	time.Sleep(5 * time.Millisecond)
+	if _, _, err = manager.Rotate(ctx, idle); !errors.Is(err, ErrRefreshTokenExpired) {
+		t.Fatalf("expected idle token expired, got: %v", err)
+	}
+}
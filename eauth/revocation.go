@@ -0,0 +1,114 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eauth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RevocationStore 访问令牌撤销列表，撤销记录只需要保存到对应令牌过期
+type RevocationStore interface {
+	// RevokeToken 撤销单个令牌
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// RevokeSubject 撤销subject在before之前签发的所有令牌，如禁用账号
+	RevokeSubject(ctx context.Context, subject string, before time.Time) error
+	// RevokeSession 撤销登录会话签发的所有令牌，如退出登录
+	RevokeSession(ctx context.Context, sid string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, claims AccountClaims) (bool, error)
+}
+
+// MemoryRevocationStore 内存撤销列表，用于测试及单实例部署
+type MemoryRevocationStore struct {
+	mutex    sync.RWMutex
+	tokens   map[string]time.Time
+	sessions map[string]time.Time
+	subjects map[string]time.Time
+	// MaxTokenLifetime subject撤销记录的保存时间，应不小于访问令牌的有效期
+	MaxTokenLifetime time.Duration
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens:           make(map[string]time.Time),
+		sessions:         make(map[string]time.Time),
+		subjects:         make(map[string]time.Time),
+		MaxTokenLifetime: 24 * time.Hour,
+	}
+}
+
+func (s *MemoryRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.prune()
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokeSubject(ctx context.Context, subject string, before time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.prune()
+	s.subjects[subject] = before
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokeSession(ctx context.Context, sid string, expiresAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.prune()
+	s.sessions[sid] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, claims AccountClaims) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if _, exist := s.tokens[claims.ID]; exist && len(claims.ID) > 0 {
+		return true, nil
+	}
+	if _, exist := s.sessions[claims.SessionID]; exist && len(claims.SessionID) > 0 {
+		return true, nil
+	}
+	if before, exist := s.subjects[claims.Subject]; exist && len(claims.Subject) > 0 {
+		// iat精确到秒，同一秒内签发的令牌也视为已撤销
+		if claims.IssuedAt == nil || claims.IssuedAt.Unix() <= before.Unix() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryRevocationStore) prune() {
+	now := time.Now()
+	for jti, expiresAt := range s.tokens {
+		if now.After(expiresAt) {
+			delete(s.tokens, jti)
+		}
+	}
+	for sid, expiresAt := range s.sessions {
+		if now.After(expiresAt) {
+			delete(s.sessions, sid)
+		}
+	}
+	for subject, before := range s.subjects {
+		if now.After(before.Add(s.MaxTokenLifetime)) {
+			delete(s.subjects, subject)
+		}
+	}
+}
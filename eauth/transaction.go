@@ -0,0 +1,187 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"github.com/efucloud/common"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const DefaultLoginTransactionTTL = 10 * time.Minute
+
+var (
+	ErrLoginTransactionNotFound = errors.New("login transaction not found")
+	ErrLoginTransactionExpired  = errors.New("login transaction expired")
+	ErrRedirectURINotAllowed    = errors.New("redirect uri not allowed")
+	ErrCodeVerifierMismatch     = errors.New("code verifier mismatch")
+	ErrCodeChallengeInvalid     = errors.New("code challenge invalid")
+)
+
+// pkcePattern RFC 7636 4.1/4.2 code_verifier及code_challenge为43到128个unreserved字符
+var pkcePattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// LoginTransaction 登录事务，从跳转登录开始到回调结束，State只能使用一次
+type LoginTransaction struct {
+	State         string    `json:"state"`
+	Nonce         string    `json:"nonce"`
+	CodeVerifier  string    `json:"codeVerifier,omitempty"` // 由服务端生成PKCE时保存，客户端提供code_challenge时为空
+	CodeChallenge string    `json:"codeChallenge"`
+	RedirectURI   string    `json:"redirectUri"`
+	App           string    `json:"app"`
+	CreatedAt     time.Time `json:"createdAt"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+}
+
+// LoginTransactionStore 登录事务存储
+type LoginTransactionStore interface {
+	Save(ctx context.Context, transaction LoginTransaction) error
+	// Take 取出并删除事务，事务不存在时返回ErrLoginTransactionNotFound
+	Take(ctx context.Context, state string) (LoginTransaction, error)
+}
+
+// LoginTransactionManager 创建及校验登录事务，重定向地址必须在应用注册的列表中
+type LoginTransactionManager struct {
+	Store LoginTransactionStore
+	TTL   time.Duration
+
+	mutex        sync.RWMutex
+	redirectURIs map[string][]string
+}
+
+func NewLoginTransactionManager(store LoginTransactionStore) *LoginTransactionManager {
+	return &LoginTransactionManager{Store: store, TTL: DefaultLoginTransactionTTL, redirectURIs: make(map[string][]string)}
+}
+
+// RegisterRedirectURIs 设置应用允许的重定向地址，地址需要完全匹配
+func (m *LoginTransactionManager) RegisterRedirectURIs(app string, redirectURIs ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.redirectURIs[app] = redirectURIs
+}
+
+// ValidateRedirectURI 校验重定向地址是否在应用的列表中
+func (m *LoginTransactionManager) ValidateRedirectURI(app, redirectURI string) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if len(redirectURI) > 0 && common.StringInArray(redirectURI, m.redirectURIs[app]) {
+		return nil
+	}
+	return ErrRedirectURINotAllowed
+}
+
+// Begin 创建登录事务，codeChallenge为客户端提供的S256 code_challenge，为空时由服务端生成code_verifier
+func (m *LoginTransactionManager) Begin(ctx context.Context, app, redirectURI, codeChallenge string) (transaction LoginTransaction, err error) {
+	if err = m.ValidateRedirectURI(app, redirectURI); err != nil {
+		return transaction, err
+	}
+	if len(codeChallenge) > 0 && !pkcePattern.MatchString(codeChallenge) {
+		return transaction, ErrCodeChallengeInvalid
+	}
+	now := time.Now()
+	transaction = LoginTransaction{
+		State:         common.NewSecureID(32),
+		Nonce:         common.NewSecureID(32),
+		CodeChallenge: codeChallenge,
+		RedirectURI:   redirectURI,
+		App:           app,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(m.TTL),
+	}
+	if len(codeChallenge) == 0 {
+		transaction.CodeVerifier = NewPKCEVerifier()
+		transaction.CodeChallenge = PKCEChallengeS256(transaction.CodeVerifier)
+	}
+	if err = m.Store.Save(ctx, transaction); err != nil {
+		return transaction, err
+	}
+	return transaction, nil
+}
+
+// Complete 校验登录回调，事务无论成功与否都会被删除
+func (m *LoginTransactionManager) Complete(ctx context.Context, param LocalLoginParam) (transaction LoginTransaction, err error) {
+	if len(param.State) == 0 {
+		return transaction, ErrLoginTransactionNotFound
+	}
+	if transaction, err = m.Store.Take(ctx, param.State); err != nil {
+		return transaction, err
+	}
+	if time.Now().After(transaction.ExpiresAt) {
+		return transaction, ErrLoginTransactionExpired
+	}
+	if param.RedirectUri != transaction.RedirectURI {
+		return transaction, ErrRedirectURINotAllowed
+	}
+	if err = m.ValidateRedirectURI(transaction.App, transaction.RedirectURI); err != nil {
+		return transaction, err
+	}
+	return transaction, nil
+}
+
+// VerifyCodeVerifier 校验code_verifier与事务的code_challenge是否匹配
+func (t LoginTransaction) VerifyCodeVerifier(codeVerifier string) error {
+	if !pkcePattern.MatchString(codeVerifier) || subtle.ConstantTimeCompare([]byte(PKCEChallengeS256(codeVerifier)), []byte(t.CodeChallenge)) != 1 {
+		return ErrCodeVerifierMismatch
+	}
+	return nil
+}
+
+// VerifyNonce 校验令牌中的nonce与事务一致
+func (t LoginTransaction) VerifyNonce(claims AccountClaims) error {
+	if len(t.Nonce) == 0 || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(t.Nonce)) != 1 {
+		return ErrNonceMismatch
+	}
+	return nil
+}
+
+// MemoryLoginTransactionStore 内存存储，用于测试及单实例部署
+type MemoryLoginTransactionStore struct {
+	mutex        sync.Mutex
+	transactions map[string]LoginTransaction
+}
+
+func NewMemoryLoginTransactionStore() *MemoryLoginTransactionStore {
+	return &MemoryLoginTransactionStore{transactions: make(map[string]LoginTransaction)}
+}
+
+func (s *MemoryLoginTransactionStore) Save(ctx context.Context, transaction LoginTransaction) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	for state, item := range s.transactions {
+		if now.After(item.ExpiresAt) {
+			delete(s.transactions, state)
+		}
+	}
+	s.transactions[transaction.State] = transaction
+	return nil
+}
+
+func (s *MemoryLoginTransactionStore) Take(ctx context.Context, state string) (LoginTransaction, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	transaction, exist := s.transactions[state]
+	if !exist {
+		return transaction, ErrLoginTransactionNotFound
+	}
+	delete(s.transactions, state)
+	return transaction, nil
+}
@@ -0,0 +1,62 @@
+package eauth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestLoginTransaction(t *testing.T) {
+	ctx := context.Background()
+	manager := NewLoginTransactionManager(NewMemoryLoginTransactionStore())
+	manager.RegisterRedirectURIs("app", "/callback", "https://app.example.com/callback")
+	if _, err := manager.Begin(ctx, "app", "https://evil.example.com/callback", ""); !errors.Is(err, ErrRedirectURINotAllowed) {
+		t.Fatalf("expected redirect uri not allowed, got: %v", err)
+	}
+	for _, challenge := range []string{"short", strings.Repeat("a", 129), strings.Repeat("a", 42) + "+"} {
+		if _, err := manager.Begin(ctx, "app", "/callback", challenge); !errors.Is(err, ErrCodeChallengeInvalid) {
+			t.Fatalf("challenge %q: expected invalid, got: %v", challenge, err)
+		}
+	}
+
+	// 客户端提供code_challenge
+	verifier := NewPKCEVerifier()
+	transaction, err := manager.Begin(ctx, "app", "/callback", PKCEChallengeS256(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	param := LocalLoginParam{Method: LoginMethodPassword, State: transaction.State, RedirectUri: "/callback"}
+	if err = validator.New().Struct(param); err != nil {
+		t.Fatalf("relative redirect uri should be valid: %v", err)
+	}
+	completed, err := manager.Complete(ctx, param)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = completed.VerifyCodeVerifier(verifier); err != nil {
+		t.Fatal(err)
+	}
+	if err = completed.VerifyCodeVerifier(NewPKCEVerifier()); !errors.Is(err, ErrCodeVerifierMismatch) {
+		t.Fatalf("expected verifier mismatch, got: %v", err)
+	}
+	if err = completed.VerifyNonce(AccountClaims{Nonce: transaction.Nonce}); err != nil {
+		t.Fatal(err)
+	}
+	// state只能使用一次
+	if _, err = manager.Complete(ctx, param); !errors.Is(err, ErrLoginTransactionNotFound) {
+		t.Fatalf("expected state to be consumed, got: %v", err)
+	}
+
+	// 服务端生成code_verifier，回调地址需要与开始时一致
+	transaction, err = manager.Begin(ctx, "app", "https://app.example.com/callback", "")
+	if err != nil || transaction.VerifyCodeVerifier(transaction.CodeVerifier) != nil {
+		t.Fatalf("server side pkce failed: %v", err)
+	}
+	param = LocalLoginParam{State: transaction.State, RedirectUri: "/callback"}
+	if _, err = manager.Complete(ctx, param); !errors.Is(err, ErrRedirectURINotAllowed) {
+		t.Fatalf("expected redirect uri mismatch, got: %v", err)
+	}
+}
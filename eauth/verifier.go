@@ -0,0 +1,140 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTokenMissing        = errors.New("token missing")
+	ErrTokenInvalid        = errors.New("token invalid")
+	ErrTokenClientMismatch = errors.New("token client id mismatch")
+	ErrTokenRevoked        = errors.New("token revoked")
+)
+
+// TokenVerifier 访问令牌校验，除签名外还会校验typ、iss、aud、exp、nbf及AppClientID
+type TokenVerifier struct {
+	VerifyKeys     []*rsa.PublicKey
+	Keyfunc        jwt.Keyfunc                           // 不为空时优先于VerifyKeys使用，如RemoteKeySet.Keyfunc
+	KeyfuncContext func(ctx context.Context) jwt.Keyfunc // 不为空时优先于Keyfunc使用，参数为VerifyContext的ctx，如RemoteKeySet.KeyfuncContext
+	Type           string                                // 令牌头的typ，忽略大小写及application/前缀，为空时不校验，如TokenTypeAccess
+	Issuer         string                                // 为空时不校验
+	Audience       []string                              // 令牌的aud包含其中任意一个即可，为空时不校验
+	ClientID       string                                // 为空时不校验AppClientID
+	Leeway         time.Duration                         // 时间校验允许的误差
+	Methods        []string                              // 允许的签名算法，为空时为RS256，使用RemoteKeySet时可设置为SupportedSigningMethods
+	Revocation     RevocationStore                       // 不为空时校验令牌是否已撤销
+}
+
+// GetUsername 用于访问日志记录用户
+func (c AccountClaims) GetUsername() string {
+	if len(c.Org) > 0 {
+		return c.Org + "/" + c.Username
+	}
+	return c.Username
+}
+
+// Verify 校验令牌并返回AccountClaims
+func (v *TokenVerifier) Verify(tokenStr string) (claims AccountClaims, err error) {
+	return v.VerifyContext(context.Background(), tokenStr)
+}
+
+// VerifyContext 校验令牌并返回AccountClaims，ctx用于查询撤销列表
+func (v *TokenVerifier) VerifyContext(ctx context.Context, tokenStr string) (claims AccountClaims, err error) {
+	if len(tokenStr) == 0 {
+		return claims, ErrTokenMissing
+	}
+	methods := v.Methods
+	if len(methods) == 0 {
+		methods = []string{jwt.SigningMethodRS256.Alg()}
+	}
+	options := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired(), jwt.WithLeeway(v.Leeway)}
+	if len(v.Issuer) > 0 {
+		options = append(options, jwt.WithIssuer(v.Issuer))
+	}
+	var keyfuncs []jwt.Keyfunc
+	if v.KeyfuncContext != nil {
+		keyfuncs = append(keyfuncs, v.KeyfuncContext(ctx))
+	} else if v.Keyfunc != nil {
+		keyfuncs = append(keyfuncs, v.Keyfunc)
+	} else {
+		for _, key := range v.VerifyKeys {
+			verifyKey := key
+			keyfuncs = append(keyfuncs, func(token *jwt.Token) (interface{}, error) {
+				return verifyKey, nil
+			})
+		}
+	}
+	err = ErrTokenInvalid
+	for _, keyfunc := range keyfuncs {
+		var cla AccountClaims
+		token, er := jwt.ParseWithClaims(tokenStr, &cla, keyfunc, options...)
+		if er == nil && !v.matchType(token) {
+			return AccountClaims{}, fmt.Errorf("%w: unexpected typ %v", ErrTokenInvalid, token.Header["typ"])
+		}
+		if er == nil {
+			claims, err = cla, nil
+			break
+		}
+		err = fmt.Errorf("%w: %s", ErrTokenInvalid, er.Error())
+	}
+	if err != nil {
+		return AccountClaims{}, err
+	}
+	if len(v.Audience) > 0 {
+		matched := false
+		for _, aud := range v.Audience {
+			for _, item := range claims.Audience {
+				if aud == item {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			return AccountClaims{}, fmt.Errorf("%w: audience mismatch", ErrTokenInvalid)
+		}
+	}
+	if len(v.ClientID) > 0 && claims.AppClientID != v.ClientID {
+		return AccountClaims{}, ErrTokenClientMismatch
+	}
+	if v.Revocation != nil {
+		revoked, err := v.Revocation.IsRevoked(ctx, claims)
+		if err != nil {
+			return AccountClaims{}, err
+		}
+		if revoked {
+			return AccountClaims{}, ErrTokenRevoked
+		}
+	}
+	return claims, nil
+}
+
+// matchType RFC 7515 第4.1.9节，typ比较时忽略大小写及application/前缀
+func (v *TokenVerifier) matchType(token *jwt.Token) bool {
+	if len(v.Type) == 0 {
+		return true
+	}
+	typ, _ := token.Header["typ"].(string)
+	return strings.EqualFold(strings.TrimPrefix(strings.ToLower(typ), "application/"), v.Type)
+}
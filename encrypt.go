@@ -4,9 +4,15 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"github.com/efucloud/common/security"
 )
 
+var ErrPaddingInvalid = errors.New("pkcs5 padding is invalid")
+
 // AesEncryptCBC /*
+// Deprecated: 使用密钥作为IV且没有认证，新数据使用security.Keyring加密
 func AesEncryptCBC(origData, key []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -21,6 +27,8 @@ func AesEncryptCBC(origData, key []byte) ([]byte, error) {
 	return encrypted, nil
 }
 
+// AesDecryptCBC 解密AesEncryptCBC生成的旧密文
+// Deprecated: 使用MigrateAesCBC转换为security.Keyring的密文
 func AesDecryptCBC(encrypted, key []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -28,11 +36,22 @@ func AesDecryptCBC(encrypted, key []byte) ([]byte, error) {
 	}
 
 	blockSize := block.BlockSize()
+	if len(encrypted) == 0 || len(encrypted)%blockSize != 0 {
+		return nil, ErrPaddingInvalid
+	}
 	blockMode := cipher.NewCBCDecrypter(block, key[:blockSize])
 	origData := make([]byte, len(encrypted))
 	blockMode.CryptBlocks(origData, encrypted)
-	origData = PKCS5UnPadding(origData)
-	return origData, nil
+	return PKCS5Unpad(origData, blockSize)
+}
+
+// MigrateAesCBC 解密AesEncryptCBC生成的旧密文，并使用keyring的当前密钥重新加密
+func MigrateAesCBC(encrypted, legacyKey []byte, keyring *security.Keyring, associatedData []byte) ([]byte, error) {
+	plaintext, err := AesDecryptCBC(encrypted, legacyKey)
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Encrypt(plaintext, associatedData)
 }
 
 func PKCS5Padding(ciphertext []byte, blockSize int) []byte {
@@ -41,8 +60,27 @@ func PKCS5Padding(ciphertext []byte, blockSize int) []byte {
 	return append(ciphertext, padText...)
 }
 
+// PKCS5UnPadding 填充不合法时返回nil，需要区分错误时使用PKCS5Unpad
 func PKCS5UnPadding(origData []byte) []byte {
+	data, err := PKCS5Unpad(origData, aes.BlockSize)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// PKCS5Unpad 校验并去除填充，所有填充字节都会被检查
+func PKCS5Unpad(origData []byte, blockSize int) ([]byte, error) {
 	length := len(origData)
+	if length == 0 || length%blockSize != 0 {
+		return nil, ErrPaddingInvalid
+	}
 	unPadding := int(origData[length-1])
-	return origData[:(length - unPadding)]
+	if unPadding == 0 || unPadding > blockSize {
+		return nil, ErrPaddingInvalid
+	}
+	if subtle.ConstantTimeCompare(origData[length-unPadding:], bytes.Repeat([]byte{byte(unPadding)}, unPadding)) != 1 {
+		return nil, ErrPaddingInvalid
+	}
+	return origData[:(length - unPadding)], nil
 }
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/efucloud/common/security"
+)
+
+func TestPKCS5Unpad(t *testing.T) {
+	for _, data := range [][]byte{nil, {}, {1, 2, 3}, bytes.Repeat([]byte{0}, 16), append(bytes.Repeat([]byte{1}, 14), 3, 2)} {
+		if _, err := PKCS5Unpad(data, 16); !errors.Is(err, ErrPaddingInvalid) {
+			t.Fatalf("%v: expected invalid padding, got %v", data, err)
+		}
+	}
+	if PKCS5UnPadding(nil) != nil {
+		t.Fatal("expected nil for empty input")
+	}
+	data, err := PKCS5Unpad(PKCS5Padding([]byte("raw"), 16), 16)
+	if err != nil || string(data) != "raw" {
+		t.Fatalf("unpad: %s, err: %v", data, err)
+	}
+}
+
+func TestMigrateAesCBC(t *testing.T) {
+	legacyKey := []byte("0123456789abcdef")
+	encrypted, err := AesEncryptCBC([]byte("this is legacy data"), legacyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := security.GenerateSymmetricKey("2024", "")
+	keyring := security.NewKeyring()
+	if err = keyring.Add(key); err != nil {
+		t.Fatal(err)
+	}
+	if err = keyring.SetActive(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	migrated, err := MigrateAesCBC(encrypted, legacyKey, keyring, []byte("account:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := keyring.Decrypt(migrated, []byte("account:1"))
+	if err != nil || string(decrypted) != "this is legacy data" {
+		t.Fatalf("decrypted: %s, err: %v", decrypted, err)
+	}
+	if _, err = MigrateAesCBC(encrypted[:len(encrypted)-1], legacyKey, keyring, nil); !errors.Is(err, ErrPaddingInvalid) {
+		t.Fatalf("expected invalid padding, got %v", err)
+	}
+}
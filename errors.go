@@ -0,0 +1,219 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrorCode 应用错误编码，Code全局唯一，MessageID为空时使用Code作为i18n信息编码
+type ErrorCode struct {
+	Code      string   `json:"code" yaml:"code" description:"错误编码"`
+	Status    int      `json:"status" yaml:"status" description:"默认响应码"`
+	MessageID string   `json:"messageId" yaml:"messageId" description:"i18n信息编码"`
+	Params    []string `json:"params" yaml:"params" description:"信息模板必须的参数"`
+}
+
+var (
+	errorCodes     = map[string]*ErrorCode{}
+	errorCodesLock = sync.RWMutex{}
+)
+
+var (
+	ErrCodeBadRequest            = RegisterErrorCode(ErrorCode{Code: "statusBadRequest", Status: http.StatusBadRequest})
+	ErrCodeUnauthorized          = RegisterErrorCode(ErrorCode{Code: "statusUnauthorized", Status: http.StatusUnauthorized})
+	ErrCodeForbidden             = RegisterErrorCode(ErrorCode{Code: "statusForbidden", Status: http.StatusForbidden})
+	ErrCodeNotFound              = RegisterErrorCode(ErrorCode{Code: "notFound", Status: http.StatusNotFound, Params: []string{"resource", "id"}})
+	ErrCodeConflict              = RegisterErrorCode(ErrorCode{Code: "conflict", Status: http.StatusConflict, Params: []string{"resource"}})
+	ErrCodeInternal              = RegisterErrorCode(ErrorCode{Code: "statusInternalServerError", Status: http.StatusInternalServerError})
+	ErrCodeInvalidQueryParameter = RegisterErrorCode(ErrorCode{Code: MsgCodeInvalidQueryParameter, Status: http.StatusBadRequest, Params: []string{"name"}})
+	ErrCodeInvalidPagination     = RegisterErrorCode(ErrorCode{Code: MsgCodeInvalidPagination, Status: http.StatusBadRequest, Params: []string{"maxPageSize", "maxOffset"}})
+)
+
+var ErrErrorParamsMissing = errors.New("error params missing")
+
+// RegisterErrorCode 注册错误编码，编码重复时panic，应在包初始化时调用
+func RegisterErrorCode(code ErrorCode) *ErrorCode {
+	if len(code.Code) == 0 {
+		panic("error code can not be empty")
+	}
+	if len(code.MessageID) == 0 {
+		code.MessageID = code.Code
+	}
+	if code.Status == 0 {
+		code.Status = http.StatusInternalServerError
+	}
+	errorCodesLock.Lock()
+	defer errorCodesLock.Unlock()
+	if _, exist := errorCodes[code.Code]; exist {
+		panic(fmt.Sprintf("error code %s already registered", code.Code))
+	}
+	errorCodes[code.Code] = &code
+	return &code
+}
+
+// GetErrorCode 根据编码获取已注册的错误编码
+func GetErrorCode(code string) (errorCode *ErrorCode, exist bool) {
+	errorCodesLock.RLock()
+	defer errorCodesLock.RUnlock()
+	errorCode, exist = errorCodes[code]
+	return
+}
+
+// ErrorCodes 返回所有已注册的错误编码，按Code排序
+func ErrorCodes() (codes []*ErrorCode) {
+	errorCodesLock.RLock()
+	defer errorCodesLock.RUnlock()
+	for _, code := range errorCodes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i].Code < codes[j].Code
+	})
+	return codes
+}
+
+// Error ErrorCode可以作为errors.Is的target
+func (c *ErrorCode) Error() string {
+	return c.Code
+}
+
+// New 创建应用错误，err为底层错误，可以为nil。
+// params缺少Params中声明的参数时，Err中会附加ErrErrorParamsMissing，可以使用errors.Is检查
+func (c *ErrorCode) New(err error, params map[string]interface{}) *AppError {
+	if er := c.CheckParams(params); er != nil {
+		err = errors.Join(err, er)
+	}
+	return &AppError{Code: c, Params: params, Err: err}
+}
+
+// CheckParams 检查params是否包含Params中声明的全部参数
+func (c *ErrorCode) CheckParams(params map[string]interface{}) error {
+	var missing []string
+	for _, name := range c.Params {
+		if _, exist := params[name]; !exist {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s requires %s", ErrErrorParamsMissing, c.Code, strings.Join(missing, ","))
+	}
+	return nil
+}
+
+// AppError 应用错误，支持errors.Is(err, ErrCodeXXX)以及errors.As
+type AppError struct {
+	Code   *ErrorCode
+	Params map[string]interface{}
+	Err    error
+}
+
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", e.Code.Code, e.Err.Error())
+	}
+	return e.Code.Code
+}
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+func (e *AppError) Is(target error) bool {
+	switch t := target.(type) {
+	case *ErrorCode:
+		return t == e.Code
+	case *AppError:
+		return t.Code == e.Code
+	}
+	return false
+}
+
+// ErrorData 转换为ErrorData，用于ResponseErrorMessage
+func (e *AppError) ErrorData(lang string) ErrorData {
+	return ErrorData{
+		Lang:         lang,
+		ResponseCode: e.Code.Status,
+		Err:          e,
+		MsgCode:      e.Code.MessageID,
+		Params:       e.Params,
+	}
+}
+
+// ErrorDataFromError 将错误转换为ErrorData，非AppError的错误作为500处理
+func ErrorDataFromError(err error, lang string) ErrorData {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		data := appErr.ErrorData(lang)
+		data.Err = err
+		return data
+	}
+	return Internal(err).ErrorData(lang)
+}
+
+func BadRequest(err error) *AppError {
+	return ErrCodeBadRequest.New(err, nil)
+}
+func Unauthorized(err error) *AppError {
+	return ErrCodeUnauthorized.New(err, nil)
+}
+func Forbidden(err error) *AppError {
+	return ErrCodeForbidden.New(err, nil)
+}
+func NotFound(resource string, id interface{}) *AppError {
+	return ErrCodeNotFound.New(fmt.Errorf("%s %v not found", resource, id), map[string]interface{}{"resource": resource, "id": id})
+}
+func Conflict(resource string, err error) *AppError {
+	return ErrCodeConflict.New(err, map[string]interface{}{"resource": resource})
+}
+func Internal(err error) *AppError {
+	return ErrCodeInternal.New(err, nil)
+}
+
+// CheckErrorTranslations 检查已注册的错误编码在bundle的每种语言中都有翻译，
+// 并且翻译模板只使用了Params中声明的参数
+func CheckErrorTranslations(bundle *i18n.Bundle) error {
+	var missing, undeclared []string
+	for _, tag := range bundle.LanguageTags() {
+		localizer := i18n.NewLocalizer(bundle, tag.String())
+		for _, code := range ErrorCodes() {
+			params := make(map[string]interface{})
+			for _, name := range code.Params {
+				params[name] = name
+			}
+			msg, err := localizer.Localize(&i18n.LocalizeConfig{MessageID: code.MessageID, TemplateData: params})
+			var notFound *i18n.MessageNotFoundErr
+			if errors.As(err, &notFound) {
+				missing = append(missing, fmt.Sprintf("%s:%s", tag.String(), code.MessageID))
+			} else if strings.Contains(msg, "<no value>") {
+				undeclared = append(undeclared, fmt.Sprintf("%s:%s", tag.String(), code.MessageID))
+			}
+		}
+	}
+	var errs []error
+	if len(missing) > 0 {
+		errs = append(errs, fmt.Errorf("missing error translations: %s", strings.Join(missing, ",")))
+	}
+	if len(undeclared) > 0 {
+		errs = append(errs, fmt.Errorf("%w: translations use undeclared params: %s", ErrErrorParamsMissing, strings.Join(undeclared, ",")))
+	}
+	return errors.Join(errs...)
+}
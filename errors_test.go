@@ -0,0 +1,50 @@
+package common
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+func TestErrorCodeParams(t *testing.T) {
+	err := NotFound("user", 1)
+	if !errors.Is(err, ErrCodeNotFound) || errors.Is(err, ErrErrorParamsMissing) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = ErrCodeNotFound.New(nil, map[string]interface{}{"resource": "user"})
+	if !errors.Is(err, ErrCodeNotFound) || !errors.Is(err, ErrErrorParamsMissing) {
+		t.Fatalf("expected missing params, got: %v", err)
+	}
+	if data := err.ErrorData(I18nEN); data.ResponseCode != 404 || data.MsgCode != "notFound" {
+		t.Fatalf("error data: %s", data.String())
+	}
+	if ErrCodeInternal.CheckParams(nil) != nil {
+		t.Fatal("code without params should not require params")
+	}
+}
+
+func TestCheckErrorTranslations(t *testing.T) {
+	code, exist := GetErrorCode("errorsTestCode")
+	if !exist {
+		code = RegisterErrorCode(ErrorCode{Code: "errorsTestCode", Status: 400, Params: []string{"name"}})
+	}
+	bundle := i18n.NewBundle(language.English)
+	var messages []*i18n.Message
+	for _, item := range ErrorCodes() {
+		messages = append(messages, &i18n.Message{ID: item.MessageID, Other: item.MessageID})
+	}
+	_ = bundle.AddMessages(language.English, messages...)
+	if err := CheckErrorTranslations(bundle); err != nil {
+		t.Fatal(err)
+	}
+	_ = bundle.AddMessages(language.English, &i18n.Message{ID: code.MessageID, Other: "{{.name}} {{.other}}"})
+	if err := CheckErrorTranslations(bundle); !errors.Is(err, ErrErrorParamsMissing) {
+		t.Fatalf("expected undeclared params, got: %v", err)
+	}
+	_ = bundle.AddMessages(language.Chinese, &i18n.Message{ID: code.MessageID, Other: "{{.name}}"})
+	if err := CheckErrorTranslations(bundle); err == nil {
+		t.Fatal("expected missing translations for zh")
+	}
+}
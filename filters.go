@@ -0,0 +1,176 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"github.com/emicklei/go-restful/v3"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"go.uber.org/zap"
+	"golang.org/x/text/language"
+	"k8s.io/klog/v2"
+	"regexp"
+	"runtime/debug"
+	"time"
+)
+
+// 推荐的过滤器顺序:
+//
+//	container.Filter(common.RequestIDFilter)
+//	container.Filter(common.NewAccessLogFilter(logger))
+//	container.Filter(common.NewRecoveryFilter(bundle, logger))
+//	container.Filter(common.NewLanguageFilter(bundle))
+
+const (
+	HeaderRequestID = "X-Request-ID"
+	// RequestIDKey 请求属性及context中保存请求ID的key
+	RequestIDKey = "RequestID"
+	// RequestClaimsKey 请求属性中保存认证信息的key
+	RequestClaimsKey = "RequestClaims"
+	// LanguageParameter 查询参数及cookie中指定语言的名称
+	LanguageParameter = "lang"
+)
+
+var requestIDReg = regexp.MustCompile(`^[a-zA-Z0-9._\-]{1,128}$`)
+
+// RequestIDFilter 透传请求头中的X-Request-ID，不存在或者不合法时生成新的ID，并写入响应头、请求属性及context
+func RequestIDFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	id := req.HeaderParameter(HeaderRequestID)
+	if !requestIDReg.MatchString(id) {
+		id = NewID()
+	}
+	req.SetAttribute(RequestIDKey, id)
+	req.Request = req.Request.WithContext(context.WithValue(req.Request.Context(), RequestIDKey, id))
+	resp.Header().Set(HeaderRequestID, id)
+	chain.ProcessFilter(req, resp)
+}
+
+// GetRequestID 获取RequestIDFilter设置的请求ID
+func GetRequestID(req *restful.Request) string {
+	if id, ok := req.Attribute(RequestIDKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// GetRequestIDFromCtx 获取RequestIDFilter设置的请求ID
+func GetRequestIDFromCtx(ctx context.Context) string {
+	if id, ok := ctx.Value(RequestIDKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// NewLanguageFilter 依次根据lang查询参数、lang cookie及Accept-Language从bundle支持的语言中协商语言，
+// 结果写入RequestLanguageKey请求属性及context，供GetLanguageFromReq、GetLangFromCtx使用
+func NewLanguageFilter(bundle *i18n.Bundle) restful.FilterFunction {
+	supported := bundle.LanguageTags()
+	matcher := language.NewMatcher(supported)
+	match := func(tags ...language.Tag) (string, bool) {
+		if len(tags) == 0 {
+			return "", false
+		}
+		_, index, confidence := matcher.Match(tags...)
+		if confidence == language.No {
+			return "", false
+		}
+		base, _ := supported[index].Base()
+		return base.String(), true
+	}
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		lang := I18nZH
+		var candidates []string
+		candidates = append(candidates, req.QueryParameter(LanguageParameter))
+		if cookie, err := req.Request.Cookie(LanguageParameter); err == nil {
+			candidates = append(candidates, cookie.Value)
+		}
+		matched := false
+		for _, item := range candidates {
+			if tag, err := language.Parse(item); err == nil {
+				if l, ok := match(tag); ok {
+					lang, matched = l, true
+					break
+				}
+			}
+		}
+		if !matched {
+			if tags, _, err := language.ParseAcceptLanguage(req.HeaderParameter("Accept-Language")); err == nil {
+				if l, ok := match(tags...); ok {
+					lang = l
+				}
+			}
+		}
+		req.SetAttribute(RequestLanguageKey, lang)
+		req.Request = req.Request.WithContext(context.WithValue(req.Request.Context(), RequestLanguageKey, lang))
+		chain.ProcessFilter(req, resp)
+	}
+}
+
+// NewRecoveryFilter 捕获处理过程中的panic，记录调用栈并通过ResponseErrorMessage返回500
+func NewRecoveryFilter(bundle *i18n.Bundle, logger *zap.SugaredLogger) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		defer func() {
+			if r := recover(); r != nil {
+				if logger != nil {
+					logger.Errorw("panic recovered", "panic", r, "requestId", GetRequestID(req),
+						"method", req.Request.Method, "path", req.Request.URL.Path, "stack", string(debug.Stack()))
+				} else {
+					klog.Errorf("panic recovered: %v, requestId: %s, stack: %s", r, GetRequestID(req), debug.Stack())
+				}
+				ResponseErrorMessage(req.Request.Context(), req, resp, bundle,
+					Internal(errors.New("internal server error")).ErrorData(GetLanguageFromReq(req, RequestLanguageKey)))
+			}
+		}()
+		chain.ProcessFilter(req, resp)
+	}
+}
+
+// NewAccessLogFilter 记录访问日志，认证信息实现GetUsername或GetSubject时记录用户
+func NewAccessLogFilter(logger *zap.SugaredLogger) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		start := time.Now()
+		chain.ProcessFilter(req, resp)
+		fields := []interface{}{
+			"method", req.Request.Method,
+			"path", req.Request.URL.Path,
+			"status", resp.StatusCode(),
+			"size", resp.ContentLength(),
+			"latency", time.Since(start),
+			"remote", req.Request.RemoteAddr,
+			"userAgent", req.Request.UserAgent(),
+		}
+		if id := GetRequestID(req); len(id) > 0 {
+			fields = append(fields, "requestId", id)
+		}
+		if user := requestUser(req); len(user) > 0 {
+			fields = append(fields, "user", user)
+		}
+		logger.Infow("access", fields...)
+	}
+}
+
+func requestUser(req *restful.Request) string {
+	switch claims := req.Attribute(RequestClaimsKey).(type) {
+	case interface{ GetUsername() string }:
+		return claims.GetUsername()
+	case interface{ GetSubject() (string, error) }:
+		sub, _ := claims.GetSubject()
+		return sub
+	}
+	return ""
+}
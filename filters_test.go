@@ -0,0 +1,121 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/go-restful/v3"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/text/language"
+)
+
+func newFilterTestContainer(logger *zap.SugaredLogger) *restful.Container {
+	bundle := i18n.NewBundle(language.Chinese)
+	_ = bundle.AddMessages(language.English, &i18n.Message{ID: "statusInternalServerError", Other: "internal server error"})
+	container := restful.NewContainer()
+	container.Filter(RequestIDFilter)
+	container.Filter(NewAccessLogFilter(logger))
+	container.Filter(NewRecoveryFilter(bundle, logger))
+	container.Filter(NewLanguageFilter(bundle))
+	ws := new(restful.WebService)
+	ws.Route(ws.GET("/info").Produces(restful.MIME_JSON).To(func(req *restful.Request, resp *restful.Response) {
+		_ = resp.WriteAsJson(map[string]string{
+			"requestId": GetRequestID(req),
+			"ctxId":     GetRequestIDFromCtx(req.Request.Context()),
+			"lang":      GetLanguageFromReq(req, RequestLanguageKey),
+			"ctxLang":   GetLangFromCtx(req.Request.Context(), RequestLanguageKey),
+		})
+	}))
+	ws.Route(ws.GET("/panic").Produces(restful.MIME_JSON).To(func(req *restful.Request, resp *restful.Response) {
+		panic("boom")
+	}))
+	container.Add(ws)
+	return container
+}
+
+func serveFilterTest(container *restful.Container, r *http.Request) (*httptest.ResponseRecorder, map[string]string) {
+	recorder := httptest.NewRecorder()
+	container.ServeHTTP(recorder, r)
+	body := make(map[string]string)
+	_ = json.Unmarshal(recorder.Body.Bytes(), &body)
+	return recorder, body
+}
+
+func TestRequestIDFilter(t *testing.T) {
+	container := newFilterTestContainer(zap.NewNop().Sugar())
+	r := httptest.NewRequest("GET", "/info", nil)
+	r.Header.Set(HeaderRequestID, "trace-1.a_b")
+	recorder, body := serveFilterTest(container, r)
+	if recorder.Header().Get(HeaderRequestID) != "trace-1.a_b" || body["requestId"] != "trace-1.a_b" || body["ctxId"] != "trace-1.a_b" {
+		t.Fatalf("request id not propagated, header: %s, body: %v", recorder.Header().Get(HeaderRequestID), body)
+	}
+	for _, id := range []string{"", "bad id\r\nX-Injected: 1", strings.Repeat("a", 129)} {
+		r = httptest.NewRequest("GET", "/info", nil)
+		if len(id) > 0 {
+			r.Header[HeaderRequestID] = []string{id}
+		}
+		recorder, body = serveFilterTest(container, r)
+		generated := recorder.Header().Get(HeaderRequestID)
+		if generated == id || !requestIDReg.MatchString(generated) || body["requestId"] != generated || body["ctxId"] != generated {
+			t.Fatalf("%q: expected generated request id, header: %s, body: %v", id, generated, body)
+		}
+	}
+}
+
+func TestLanguageFilter(t *testing.T) {
+	container := newFilterTestContainer(zap.NewNop().Sugar())
+	cases := []struct {
+		query, cookie, accept string
+		expected              string
+	}{
+		{expected: I18nZH},
+		{accept: "en-US,en;q=0.9", expected: I18nEN},
+		{cookie: "en", accept: "zh-CN", expected: I18nEN},
+		{query: "zh", cookie: "en", accept: "en", expected: I18nZH},
+		{query: "fr", cookie: "en", accept: "zh", expected: I18nEN},
+		{query: "invalid!", accept: "en", expected: I18nEN},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/info?lang="+c.query, nil)
+		if len(c.cookie) > 0 {
+			r.AddCookie(&http.Cookie{Name: LanguageParameter, Value: c.cookie})
+		}
+		if len(c.accept) > 0 {
+			r.Header.Set("Accept-Language", c.accept)
+		}
+		_, body := serveFilterTest(container, r)
+		if body["lang"] != c.expected || body["ctxLang"] != c.expected {
+			t.Fatalf("%+v: got %v", c, body)
+		}
+	}
+}
+
+func TestRecoveryFilter(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	container := newFilterTestContainer(zap.New(core).Sugar())
+	r := httptest.NewRequest("GET", "/panic?lang=en", nil)
+	r.Header.Set("Accept", restful.MIME_JSON)
+	recorder, _ := serveFilterTest(container, r)
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("status: %d", recorder.Code)
+	}
+	var body ResponseError
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Message != "statusInternalServerError" || strings.Contains(recorder.Body.String(), "boom") {
+		t.Fatalf("unexpected body: %s", recorder.Body.String())
+	}
+	if logs.FilterMessage("panic recovered").Len() != 1 {
+		t.Fatal("panic not logged")
+	}
+	access := logs.FilterMessage("access").All()
+	if len(access) != 1 || access[0].ContextMap()["status"] != int64(http.StatusInternalServerError) {
+		t.Fatalf("access log: %+v", access)
+	}
+}
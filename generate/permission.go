@@ -0,0 +1,135 @@
+package generate
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/efucloud/common/eauth"
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	restful "github.com/emicklei/go-restful/v3"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PermissionRoles 权限及拥有该权限的角色
+type PermissionRoles struct {
+	Resource string   `json:"resource" yaml:"resource" description:"资源"`
+	Action   string   `json:"action" yaml:"action" description:"操作"`
+	Roles    []string `json:"roles" yaml:"roles" description:"拥有该权限的角色，按等级从高到低排列"`
+}
+
+// RoutePermission 路由及其需要的权限
+type RoutePermission struct {
+	Method      string            `json:"method" yaml:"method" description:"请求方法"`
+	Path        string            `json:"path" yaml:"path" description:"请求地址"`
+	Doc         string            `json:"doc,omitempty" yaml:"doc,omitempty" description:"接口说明"`
+	Tags        []string          `json:"tags,omitempty" yaml:"tags,omitempty" description:"接口分组"`
+	Public      bool              `json:"public" yaml:"public" description:"是否无需授权"`
+	Undeclared  bool              `json:"undeclared" yaml:"undeclared" description:"既未声明权限也未标记为Public"`
+	Permissions []PermissionRoles `json:"permissions" yaml:"permissions" description:"需要的权限"`
+}
+
+// PermissionManifest 权限清单，用于管理端展示角色编辑及审计权限覆盖情况
+type PermissionManifest struct {
+	Roles      []string          `json:"roles" yaml:"roles" description:"所有角色，按等级从高到低排列"`
+	Routes     []RoutePermission `json:"routes" yaml:"routes" description:"路由权限"`
+	Undeclared []string          `json:"undeclared" yaml:"undeclared" description:"未声明权限的路由"`
+}
+
+// PermissionAPI 根据路由元数据eauth.MetadataPermissions及eauth.MetadataPublic生成权限清单
+type PermissionAPI struct {
+	policy *eauth.Policy
+	routes []restful.Route
+}
+
+func NewPermissionAPI(policy *eauth.Policy) *PermissionAPI {
+	if policy == nil {
+		policy = eauth.NewPolicy()
+	}
+	return &PermissionAPI{policy: policy}
+}
+
+func (p *PermissionAPI) AddRoute(route restful.Route) {
+	p.routes = append(p.routes, route)
+}
+
+func (p *PermissionAPI) AddWebService(ws *restful.WebService) {
+	p.routes = append(p.routes, ws.Routes()...)
+}
+
+// Generate 生成权限清单，路由按地址、请求方法排序
+func (p *PermissionAPI) Generate() (manifest PermissionManifest) {
+	for role, level := range eauth.RoleLevels {
+		if level > 0 {
+			manifest.Roles = append(manifest.Roles, role)
+		}
+	}
+	sort.Slice(manifest.Roles, func(i, j int) bool {
+		return eauth.RoleLevels[manifest.Roles[i]] > eauth.RoleLevels[manifest.Roles[j]]
+	})
+	for _, route := range p.routes {
+		permissions, public := eauth.RoutePermissions(route.Metadata)
+		item := RoutePermission{
+			Method:      route.Method,
+			Path:        route.Path,
+			Doc:         route.Doc,
+			Public:      public,
+			Undeclared:  !public && len(permissions) == 0,
+			Permissions: make([]PermissionRoles, 0, len(permissions)),
+		}
+		if tags, exist := route.Metadata[restfulspec.KeyOpenAPITags].([]string); exist {
+			item.Tags = tags
+		}
+		for _, permission := range permissions {
+			item.Permissions = append(item.Permissions, PermissionRoles{
+				Resource: permission.Resource,
+				Action:   permission.Action,
+				Roles:    p.policy.Roles(permission),
+			})
+		}
+		manifest.Routes = append(manifest.Routes, item)
+	}
+	sort.Slice(manifest.Routes, func(i, j int) bool {
+		if manifest.Routes[i].Path != manifest.Routes[j].Path {
+			return manifest.Routes[i].Path < manifest.Routes[j].Path
+		}
+		return manifest.Routes[i].Method < manifest.Routes[j].Method
+	})
+	manifest.Undeclared = make([]string, 0)
+	for _, item := range manifest.Routes {
+		if item.Undeclared {
+			manifest.Undeclared = append(manifest.Undeclared, item.Method+" "+item.Path)
+		}
+	}
+	return manifest
+}
+
+// GenerateJSON 生成JSON格式的权限清单
+func (p *PermissionAPI) GenerateJSON() ([]byte, error) {
+	return json.MarshalIndent(p.Generate(), "", "  ")
+}
+
+// GenerateYAML 生成YAML格式的权限清单
+func (p *PermissionAPI) GenerateYAML() ([]byte, error) {
+	return yaml.Marshal(p.Generate())
+}
+
+// GenerateToFile 根据文件后缀生成.json或者.yaml/.yml格式的权限清单
+func (p *PermissionAPI) GenerateToFile(file string) error {
+	var data []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		data, err = p.GenerateJSON()
+	case ".yaml", ".yml":
+		data, err = p.GenerateYAML()
+	default:
+		return fmt.Errorf("unsupported permission manifest format: %s", file)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
@@ -0,0 +1,61 @@
+package generate
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/efucloud/common/eauth"
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	restful "github.com/emicklei/go-restful/v3"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPermissionManifest(t *testing.T) {
+	policy := eauth.NewPolicy().Allow(eauth.Permission{Resource: "app", Action: eauth.ActionDelete}, eauth.RoleAdmin)
+	ws := new(restful.WebService)
+	handler := func(req *restful.Request, resp *restful.Response) {}
+	ws.Route(ws.DELETE("/apps/{id}").To(handler).Doc("delete app").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"app"}).
+		Metadata(eauth.RequirePermission("app", eauth.ActionDelete)))
+	ws.Route(ws.GET("/health").To(handler).Metadata(eauth.Public()))
+	ws.Route(ws.GET("/apps").To(handler))
+	api := NewPermissionAPI(policy)
+	api.AddWebService(ws)
+
+	manifest := api.Generate()
+	if !reflect.DeepEqual(manifest.Roles, []string{eauth.RoleAdmin, eauth.RoleEdit, eauth.RoleView}) {
+		t.Fatalf("roles: %v", manifest.Roles)
+	}
+	if len(manifest.Routes) != 3 || manifest.Routes[0].Path != "/apps" || manifest.Routes[1].Path != "/apps/{id}" || manifest.Routes[2].Path != "/health" {
+		t.Fatalf("routes: %+v", manifest.Routes)
+	}
+	deleteRoute := manifest.Routes[1]
+	expected := []PermissionRoles{{Resource: "app", Action: eauth.ActionDelete, Roles: []string{eauth.RoleAdmin}}}
+	if deleteRoute.Doc != "delete app" || !reflect.DeepEqual(deleteRoute.Tags, []string{"app"}) || !reflect.DeepEqual(deleteRoute.Permissions, expected) {
+		t.Fatalf("delete route: %+v", deleteRoute)
+	}
+	if !manifest.Routes[2].Public || manifest.Routes[2].Undeclared {
+		t.Fatalf("health route: %+v", manifest.Routes[2])
+	}
+	if !reflect.DeepEqual(manifest.Undeclared, []string{"GET /apps"}) {
+		t.Fatalf("undeclared: %v", manifest.Undeclared)
+	}
+
+	dir := t.TempDir()
+	for file, unmarshal := range map[string]func([]byte, interface{}) error{"permissions.json": json.Unmarshal, "permissions.yaml": yaml.Unmarshal} {
+		if err := api.GenerateToFile(filepath.Join(dir, file)); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := os.ReadFile(filepath.Join(dir, file))
+		var decoded PermissionManifest
+		if err := unmarshal(data, &decoded); err != nil || !reflect.DeepEqual(decoded, manifest) {
+			t.Fatalf("%s: decoded manifest mismatch, err: %v", file, err)
+		}
+	}
+	if err := api.GenerateToFile(filepath.Join(dir, "permissions.txt")); err == nil {
+		t.Fatal("expected unsupported format error")
+	}
+}
@@ -53,9 +53,14 @@ func (a ApiInfo) Tags() []string {
 	return []string{a.Tag}
 }
 
+// GetRequestPaginationInformation order为请求的原始参数，传给数据库前应使用GetRequestOrder进行白名单校验
+// 分页参数按DefaultPaginationPolicy截断
 func GetRequestPaginationInformation(req *restful.Request) (current int, pageSize int, order string) {
-	current = String2Int(req.QueryParameter("current"), DefaultPage)
-	pageSize = String2Int(req.QueryParameter("pageSize"), DefaultPageSize)
+	policy := DefaultPaginationPolicy
+	policy.Overflow = PaginationOverflowClamp
+	page, _ := policy.Apply(String2Int(req.QueryParameter("current"), DefaultPage),
+		String2Int(req.QueryParameter("pageSize"), policy.DefaultPageSize))
+	current, pageSize = page.Current, page.PageSize
 	order = req.QueryParameter("order")
 	if len(order) == 0 {
 		order = DefaultOrder
@@ -138,10 +143,16 @@ func ResponseAuthRedirect(ctx context.Context, resp *restful.Response, bundle *i
 	body.Message = message
 	body.Params = params
 	body.AuthorizationEndpoint = authorizationEndpoint
-	body.Alert, _ = GetLocaleMessage(bundle, nil, lang, "statusUnauthorized")
+	body.Alert, _ = GetLocaleMessage(bundle, nil, lang, ErrCodeUnauthorized.MessageID)
 	_ = resp.WriteHeaderAndJson(http.StatusUnauthorized, body, restful.MIME_JSON)
 }
+
+// ResponseErrorMessage 请求的Accept头包含application/problem+json时以RFC 7807格式返回，否则返回ResponseError
 func ResponseErrorMessage(ctx context.Context, req *restful.Request, resp *restful.Response, bundle *i18n.Bundle, detail ErrorData) {
+	if AcceptProblemJSON(req) {
+		writeProblem(ctx, req, resp, bundle, detail, 2)
+		return
+	}
 	if detail.ResponseCode == 0 {
 		detail.ResponseCode = http.StatusInternalServerError
 	}
@@ -411,7 +422,7 @@ func NewHTTPClientWithCA(rootCA string, insecureSkipVerify bool) (client *http.C
 func GetLangFromCtx(ctx context.Context, key string) (lang string) {
 	lang = "zh"
 	if len(key) == 0 {
-		key = "RequestLanguage"
+		key = RequestLanguageKey
 	}
 	lan := ctx.Value(key)
 	if lan != nil {
@@ -62,6 +62,9 @@ func I18nInit(i18nFiles embed.FS, logger *zap.SugaredLogger) (bundle *i18n.Bundl
 	if err != nil {
 		logger.Fatalf("load i18n message file failed, err: %s", err.Error())
 	}
+	if err = CheckErrorTranslations(bundle); err != nil {
+		logger.Warnf("check i18n error translations failed, err: %s", err.Error())
+	}
 	return
 }
 func GetLocaleMessage(bundle *i18n.Bundle, templateData map[string]interface{}, lang string, id string) (msg string, err error) {
@@ -109,11 +112,12 @@ func ValidateTransCtx(ctx context.Context, unTrans *ut.UniversalTranslator, ctxL
 
 type ErrorData struct {
 	Depth        int                    `json:"-" description:"深度"`
-	Lang         string                 `json:"lang"`         // 语言
-	ResponseCode int                    `json:"responseCode"` // 响应头编码
-	Err          error                  `json:"error"`        // 错误信息
-	MsgCode      string                 `json:"msgCode"`      // i18n 信息编码
-	Params       map[string]interface{} `json:"params"`       // 需要渲染的参数
+	Lang         string                 `json:"lang"`             // 语言
+	ResponseCode int                    `json:"responseCode"`     // 响应头编码
+	Err          error                  `json:"error"`            // 错误信息
+	MsgCode      string                 `json:"msgCode"`          // i18n 信息编码
+	Params       map[string]interface{} `json:"params"`           // 需要渲染的参数
+	Fields       FiledValidFailed       `json:"fields,omitempty"` // 字段校验失败信息
 }
 
 func (ed ErrorData) IsNotNil() bool {
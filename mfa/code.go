@@ -0,0 +1,274 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mfa
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/efucloud/common/eauth"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sender 发送验证码，如短信、邮件
+type Sender interface {
+	Send(ctx context.Context, target, code string, ttl time.Duration) error
+}
+
+// SenderFunc 函数形式的Sender
+type SenderFunc func(ctx context.Context, target, code string, ttl time.Duration) error
+
+func (f SenderFunc) Send(ctx context.Context, target, code string, ttl time.Duration) error {
+	return f(ctx, target, code, ttl)
+}
+
+// CodeRecord 验证码及发送、验证状态，Hash为验证码的HMAC
+type CodeRecord struct {
+	Hash         string      `json:"hash"`
+	ExpiresAt    time.Time   `json:"expiresAt"`
+	Attempts     int         `json:"attempts"`     // LockoutDuration内连续失败的次数，重新发送验证码不会重置
+	LastFailedAt time.Time   `json:"lastFailedAt"` // 最近一次验证失败的时间
+	Sends        []time.Time `json:"sends"`        // 最近一个小时内的发送时间
+	LockedUntil  time.Time   `json:"lockedUntil"`
+}
+
+// CodeStore 验证码存储，key为method:target
+type CodeStore interface {
+	// Get 记录不存在时返回零值
+	Get(ctx context.Context, key string) (CodeRecord, error)
+	Save(ctx context.Context, key string, record CodeRecord) error
+}
+
+// CodeManager 生成、发送及校验邮件、短信验证码，零值字段使用默认值
+type CodeManager struct {
+	Store   CodeStore
+	Senders map[string]Sender // key为MethodSMS、MethodEmail
+	Secret  []byte            // 计算验证码HMAC的密钥
+
+	Length          int           // 验证码位数，默认6位
+	TTL             time.Duration // 有效期，默认5分钟
+	ResendInterval  time.Duration // 两次发送的最小间隔，默认60秒
+	MaxSendsPerHour int           // 每小时最多发送次数，默认5次
+	MaxAttempts     int           // 最多失败次数，默认5次
+	LockoutDuration time.Duration // 失败次数过多后的锁定时间，默认15分钟
+
+	mutex sync.Mutex
+}
+
+func NewCodeManager(store CodeStore, secret []byte) *CodeManager {
+	return &CodeManager{Store: store, Secret: secret, Senders: make(map[string]Sender)}
+}
+
+func orDefault[T int | time.Duration](value, defaultValue T) T {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func (m *CodeManager) key(method, target string) string {
+	return method + ":" + strings.ToLower(strings.TrimSpace(target))
+}
+
+func (m *CodeManager) hash(key, code string) string {
+	h := hmac.New(sha256.New, m.Secret)
+	h.Write([]byte(key + ":" + code))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func randomDigits(length int) (string, error) {
+	var builder strings.Builder
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		builder.WriteByte(byte('0' + n.Int64()))
+	}
+	return builder.String(), nil
+}
+
+// Send 生成验证码并发送，发送过于频繁时返回ErrTooManyRequests，锁定期内返回ErrLocked
+func (m *CodeManager) Send(ctx context.Context, method, target string) error {
+	sender, exist := m.Senders[method]
+	if !exist {
+		return ErrMethodNotSupported
+	}
+	code, ttl, err := m.issue(ctx, method, target)
+	if err != nil {
+		return err
+	}
+	// 发送短信、邮件时不持有锁，避免所有用户的发送串行执行
+	if err = sender.Send(ctx, target, code, ttl); err != nil {
+		return fmt.Errorf("send %s verification code failed, err: %s", method, err.Error())
+	}
+	return nil
+}
+
+// issue 在锁内校验发送频率并保存新的验证码
+func (m *CodeManager) issue(ctx context.Context, method, target string) (code string, ttl time.Duration, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := m.key(method, target)
+	record, err := m.Store.Get(ctx, key)
+	if err != nil {
+		return "", 0, err
+	}
+	now := time.Now()
+	if now.Before(record.LockedUntil) {
+		return "", 0, ErrLocked
+	}
+	var sends []time.Time
+	for _, sent := range record.Sends {
+		if now.Sub(sent) < time.Hour {
+			sends = append(sends, sent)
+		}
+	}
+	if len(sends) > 0 && now.Sub(sends[len(sends)-1]) < orDefault(m.ResendInterval, time.Minute) {
+		return "", 0, ErrTooManyRequests
+	}
+	if len(sends) >= orDefault(m.MaxSendsPerHour, 5) {
+		return "", 0, ErrTooManyRequests
+	}
+	if code, err = randomDigits(orDefault(m.Length, 6)); err != nil {
+		return "", 0, err
+	}
+	ttl = orDefault(m.TTL, 5*time.Minute)
+	// 保留失败次数，避免通过重新发送验证码绕过锁定
+	record = CodeRecord{
+		Hash:         m.hash(key, code),
+		ExpiresAt:    now.Add(ttl),
+		Attempts:     m.attempts(record, now),
+		LastFailedAt: record.LastFailedAt,
+		Sends:        append(sends, now),
+	}
+	if err = m.Store.Save(ctx, key, record); err != nil {
+		return "", 0, err
+	}
+	return code, ttl, nil
+}
+
+// Verify 校验验证码，成功后验证码失效，连续失败MaxAttempts次后锁定LockoutDuration
+func (m *CodeManager) Verify(ctx context.Context, method, target, code string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := m.key(method, target)
+	record, err := m.Store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if now.Before(record.LockedUntil) {
+		return ErrLocked
+	}
+	if len(record.Hash) == 0 {
+		return ErrCodeInvalid
+	}
+	if now.After(record.ExpiresAt) {
+		return ErrCodeExpired
+	}
+	if !hmac.Equal([]byte(record.Hash), []byte(m.hash(key, strings.TrimSpace(code)))) {
+		record.Attempts = m.attempts(record, now) + 1
+		record.LastFailedAt = now
+		verifyErr := ErrCodeInvalid
+		if record.Attempts >= orDefault(m.MaxAttempts, 5) {
+			record.Hash = ""
+			record.Attempts = 0
+			record.LockedUntil = now.Add(orDefault(m.LockoutDuration, 15*time.Minute))
+			verifyErr = ErrLocked
+		}
+		if err = m.Store.Save(ctx, key, record); err != nil {
+			return err
+		}
+		return verifyErr
+	}
+	record.Hash = ""
+	record.Attempts = 0
+	return m.Store.Save(ctx, key, record)
+}
+
+// attempts LockoutDuration内没有失败记录时重新计数
+func (m *CodeManager) attempts(record CodeRecord, now time.Time) int {
+	if now.Sub(record.LastFailedAt) >= orDefault(m.LockoutDuration, 15*time.Minute) {
+		return 0
+	}
+	return record.Attempts
+}
+
+// LoginTarget 根据LocalLoginParam的登录方式返回验证方式及接收方
+func LoginTarget(param eauth.LocalLoginParam) (method, target string, err error) {
+	switch param.Method {
+	case eauth.LoginMethodPhoneCode:
+		method, target = MethodSMS, param.Phone
+	case eauth.LoginMethodEmailCode:
+		method, target = MethodEmail, param.Email
+	default:
+		return "", "", ErrMethodNotSupported
+	}
+	if len(strings.TrimSpace(target)) == 0 {
+		return "", "", errors.New("verification target can not be empty")
+	}
+	return method, target, nil
+}
+
+// SendLoginCode 为phoneCode、emailCode登录发送验证码
+func (m *CodeManager) SendLoginCode(ctx context.Context, param eauth.LocalLoginParam) error {
+	method, target, err := LoginTarget(param)
+	if err != nil {
+		return err
+	}
+	return m.Send(ctx, method, target)
+}
+
+// VerifyLogin 校验phoneCode、emailCode登录的ValidCode
+func (m *CodeManager) VerifyLogin(ctx context.Context, param eauth.LocalLoginParam) error {
+	method, target, err := LoginTarget(param)
+	if err != nil {
+		return err
+	}
+	return m.Verify(ctx, method, target, param.ValidCode)
+}
+
+// MemoryCodeStore 内存存储，用于测试及单实例部署
+type MemoryCodeStore struct {
+	mutex   sync.Mutex
+	records map[string]CodeRecord
+}
+
+func NewMemoryCodeStore() *MemoryCodeStore {
+	return &MemoryCodeStore{records: make(map[string]CodeRecord)}
+}
+
+func (s *MemoryCodeStore) Get(ctx context.Context, key string) (CodeRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.records[key], nil
+}
+
+func (s *MemoryCodeStore) Save(ctx context.Context, key string, record CodeRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records[key] = record
+	return nil
+}
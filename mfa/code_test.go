@@ -0,0 +1,128 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCodeManager(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryCodeStore()
+	manager := NewCodeManager(store, []byte("secret"))
+	manager.MaxAttempts = 3
+	var sent string
+	manager.Senders[MethodSMS] = SenderFunc(func(ctx context.Context, target, code string, ttl time.Duration) error {
+		sent = code
+		return nil
+	})
+	key := manager.key(MethodSMS, "13800000000")
+	// 允许重新发送，将上次发送时间提前
+	allowResend := func() {
+		record, _ := store.Get(ctx, key)
+		for i := range record.Sends {
+			record.Sends[i] = record.Sends[i].Add(-2 * time.Minute)
+		}
+		_ = store.Save(ctx, key, record)
+	}
+
+	if err := manager.Send(ctx, MethodEmail, "a@example.com"); !errors.Is(err, ErrMethodNotSupported) {
+		t.Fatalf("expected method not supported, got: %v", err)
+	}
+	if err := manager.Send(ctx, MethodSMS, "13800000000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Send(ctx, MethodSMS, "13800000000"); !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("expected resend interval, got: %v", err)
+	}
+	if err := manager.Verify(ctx, MethodSMS, "13800000000", sent); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Verify(ctx, MethodSMS, "13800000000", sent); !errors.Is(err, ErrCodeInvalid) {
+		t.Fatalf("expected used code rejected, got: %v", err)
+	}
+
+	// 重新发送不会重置失败次数
+	for i := 0; i < 2; i++ {
+		allowResend()
+		if err := manager.Send(ctx, MethodSMS, "13800000000"); err != nil {
+			t.Fatal(err)
+		}
+		if err := manager.Verify(ctx, MethodSMS, "13800000000", "wrong"); !errors.Is(err, ErrCodeInvalid) {
+			t.Fatalf("expected invalid code, got: %v", err)
+		}
+	}
+	allowResend()
+	if err := manager.Send(ctx, MethodSMS, "13800000000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Verify(ctx, MethodSMS, "13800000000", "wrong"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected locked, got: %v", err)
+	}
+	if err := manager.Verify(ctx, MethodSMS, "13800000000", sent); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected locked, got: %v", err)
+	}
+	allowResend()
+	if err := manager.Send(ctx, MethodSMS, "13800000000"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected send locked, got: %v", err)
+	}
+
+	// 锁定结束后重新计数
+	record, _ := store.Get(ctx, key)
+	record.LockedUntil = time.Now().Add(-time.Second)
+	record.LastFailedAt = time.Now().Add(-time.Hour)
+	_ = store.Save(ctx, key, record)
+	if err := manager.Send(ctx, MethodSMS, "13800000000"); err != nil {
+		t.Fatal(err)
+	}
+	if record, _ = store.Get(ctx, key); record.Attempts != 0 {
+		t.Fatalf("expected attempts reset after lockout, got %d", record.Attempts)
+	}
+
+	// 每小时最多发送次数
+	record.Sends = nil
+	for i := 0; i < 5; i++ {
+		record.Sends = append(record.Sends, time.Now().Add(-time.Duration(50-i)*time.Minute))
+	}
+	_ = store.Save(ctx, key, record)
+	if err := manager.Send(ctx, MethodSMS, "13800000000"); !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("expected hourly limit, got: %v", err)
+	}
+}
+
+func TestCodeManagerConcurrentSend(t *testing.T) {
+	ctx := context.Background()
+	manager := NewCodeManager(NewMemoryCodeStore(), []byte("secret"))
+	blocked, started := make(chan struct{}), make(chan struct{})
+	manager.Senders[MethodSMS] = SenderFunc(func(ctx context.Context, target, code string, ttl time.Duration) error {
+		if target == "13800000000" {
+			close(started)
+			<-blocked
+		}
+		return nil
+	})
+	slow := make(chan error)
+	go func() {
+		slow <- manager.Send(ctx, MethodSMS, "13800000000")
+	}()
+	<-started
+
+	// 一个用户的发送阻塞时不影响其它用户
+	done := make(chan error)
+	go func() {
+		done <- manager.Send(ctx, MethodSMS, "13900000000")
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("send blocked by another target")
+	}
+	close(blocked)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+}
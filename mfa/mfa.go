@@ -0,0 +1,38 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mfa 多因素认证，支持TOTP(RFC 6238)以及通过邮件、短信发送的一次性验证码
+package mfa
+
+import "errors"
+
+// 组织可以启用的多因素认证方式
+const (
+	MethodTOTP  = "totp"
+	MethodSMS   = "sms"
+	MethodEmail = "email"
+)
+
+var (
+	ErrCodeInvalid  = errors.New("verification code invalid")
+	ErrCodeExpired  = errors.New("verification code expired")
+	ErrCodeReplayed = errors.New("verification code already used")
+	// ErrTooManyRequests 发送验证码过于频繁
+	ErrTooManyRequests = errors.New("too many verification code requests")
+	// ErrLocked 验证失败次数过多，在锁定期内不能再验证
+	ErrLocked             = errors.New("too many failed attempts, locked")
+	ErrMethodNotSupported = errors.New("mfa method not supported")
+)
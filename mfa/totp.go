@@ -0,0 +1,222 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	AlgorithmSHA1   = "SHA1"
+	AlgorithmSHA256 = "SHA256"
+	AlgorithmSHA512 = "SHA512"
+
+	DefaultRecoveryCodeCount = 10
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTP RFC 6238 基于时间的一次性密码，零值字段使用默认值：6位、30秒、SHA1、前后各允许1个周期的误差
+type TOTP struct {
+	Issuer    string `json:"issuer" yaml:"issuer" description:"显示在认证器中的签发者"`
+	Digits    int    `json:"digits" yaml:"digits" description:"密码位数"`
+	Period    int    `json:"period" yaml:"period" description:"时间步长，单位秒"`
+	Skew      int    `json:"skew" yaml:"skew" description:"允许的前后周期数"`
+	Algorithm string `json:"algorithm" yaml:"algorithm" description:"HMAC算法，SHA1/SHA256/SHA512"`
+}
+
+// TOTPEnrollment 绑定TOTP的信息，Secret及RecoveryCodeHashes需要保存，URI及RecoveryCodes只展示给用户一次
+type TOTPEnrollment struct {
+	Secret             string   `json:"secret"`
+	URI                string   `json:"uri"`
+	RecoveryCodes      []string `json:"recoveryCodes"`
+	RecoveryCodeHashes []string `json:"-"`
+}
+
+func (t TOTP) digits() int {
+	if t.Digits > 0 {
+		return t.Digits
+	}
+	return 6
+}
+
+// period 时间步长的秒数，与otpauth地址中的period一致
+func (t TOTP) period() int64 {
+	if t.Period > 0 {
+		return int64(t.Period)
+	}
+	return 30
+}
+
+func (t TOTP) skew() int {
+	if t.Skew > 0 {
+		return t.Skew
+	}
+	return 1
+}
+
+func (t TOTP) algorithm() (string, func() hash.Hash, error) {
+	switch strings.ToUpper(t.Algorithm) {
+	case "", AlgorithmSHA1:
+		return AlgorithmSHA1, sha1.New, nil
+	case AlgorithmSHA256:
+		return AlgorithmSHA256, sha256.New, nil
+	case AlgorithmSHA512:
+		return AlgorithmSHA512, sha512.New, nil
+	}
+	return "", nil, fmt.Errorf("unsupported totp algorithm: %s", t.Algorithm)
+}
+
+// GenerateSecret 生成160位的base32密钥
+func GenerateSecret() string {
+	buff := make([]byte, 20)
+	if _, err := io.ReadFull(rand.Reader, buff); err != nil {
+		panic(err)
+	}
+	return base32NoPadding.EncodeToString(buff)
+}
+
+// Enroll 为账号生成密钥、otpauth地址及恢复码
+func (t TOTP) Enroll(account string) (enrollment TOTPEnrollment, err error) {
+	enrollment.Secret = GenerateSecret()
+	if enrollment.URI, err = t.URI(account, enrollment.Secret); err != nil {
+		return enrollment, err
+	}
+	enrollment.RecoveryCodes, enrollment.RecoveryCodeHashes = GenerateRecoveryCodes(DefaultRecoveryCodeCount)
+	return enrollment, nil
+}
+
+// URI 生成认证器扫码使用的otpauth://totp地址
+func (t TOTP) URI(account, secret string) (string, error) {
+	algorithm, _, err := t.algorithm()
+	if err != nil {
+		return "", err
+	}
+	label := account
+	if len(t.Issuer) > 0 {
+		label = t.Issuer + ":" + account
+	}
+	query := url.Values{}
+	query.Set("secret", secret)
+	if len(t.Issuer) > 0 {
+		query.Set("issuer", t.Issuer)
+	}
+	query.Set("algorithm", algorithm)
+	query.Set("digits", fmt.Sprintf("%d", t.digits()))
+	query.Set("period", fmt.Sprintf("%d", t.period()))
+	// 部分认证器不能识别+表示的空格
+	return "otpauth://totp/" + url.PathEscape(label) + "?" + strings.ReplaceAll(query.Encode(), "+", "%20"), nil
+}
+
+// Code 生成指定时间的密码
+func (t TOTP) Code(secret string, at time.Time) (string, error) {
+	return t.code(secret, at.Unix()/t.period())
+}
+
+func (t TOTP) code(secret string, counter int64) (string, error) {
+	_, hashFunc, err := t.algorithm()
+	if err != nil {
+		return "", err
+	}
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(strings.TrimRight(strings.ReplaceAll(secret, " ", ""), "=")))
+	if err != nil {
+		return "", fmt.Errorf("decode totp secret failed, err: %s", err.Error())
+	}
+	mac := hmac.New(hashFunc, key)
+	_ = binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := int64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+	modulo := int64(1)
+	for i := 0; i < t.digits(); i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", t.digits(), value%modulo), nil
+}
+
+// Verify 校验密码，lastCounter为上次验证成功的周期，同一周期及之前的密码会被拒绝以防重放，
+// 验证成功时返回本次的周期，调用方需要保存
+func (t TOTP) Verify(secret, code string, at time.Time, lastCounter int64) (counter int64, err error) {
+	if len(code) != t.digits() {
+		return lastCounter, ErrCodeInvalid
+	}
+	current := at.Unix() / t.period()
+	for i := -t.skew(); i <= t.skew(); i++ {
+		expected, err := t.code(secret, current+int64(i))
+		if err != nil {
+			return lastCounter, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			if current+int64(i) <= lastCounter {
+				return lastCounter, ErrCodeReplayed
+			}
+			return current + int64(i), nil
+		}
+	}
+	return lastCounter, ErrCodeInvalid
+}
+
+// GenerateRecoveryCodes 生成恢复码及其摘要，恢复码格式为xxxxx-xxxxx
+func GenerateRecoveryCodes(count int) (codes, hashes []string) {
+	for i := 0; i < count; i++ {
+		buff := make([]byte, 7)
+		if _, err := io.ReadFull(rand.Reader, buff); err != nil {
+			panic(err)
+		}
+		code := strings.ToLower(base32NoPadding.EncodeToString(buff))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// UseRecoveryCode 校验恢复码，成功时返回去掉该恢复码后的摘要列表，调用方需要保存
+func UseRecoveryCode(code string, hashes []string) (remaining []string, err error) {
+	hashed := hashRecoveryCode(code)
+	matched := false
+	for _, item := range hashes {
+		if !matched && subtle.ConstantTimeCompare([]byte(item), []byte(hashed)) == 1 {
+			matched = true
+			continue
+		}
+		remaining = append(remaining, item)
+	}
+	if !matched {
+		return hashes, ErrCodeInvalid
+	}
+	return remaining, nil
+}
@@ -0,0 +1,81 @@
+package mfa
+
+import (
+	"encoding/base32"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录B的测试向量
+func TestTOTPCode(t *testing.T) {
+	secrets := map[string]string{
+		AlgorithmSHA1:   "12345678901234567890",
+		AlgorithmSHA256: "12345678901234567890123456789012",
+		AlgorithmSHA512: "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	cases := []struct {
+		unix      int64
+		algorithm string
+		code      string
+	}{
+		{59, AlgorithmSHA1, "94287082"},
+		{59, AlgorithmSHA256, "46119246"},
+		{59, AlgorithmSHA512, "90693936"},
+		{1111111109, AlgorithmSHA1, "07081804"},
+		{1234567890, AlgorithmSHA256, "91819424"},
+		{20000000000, AlgorithmSHA512, "47863826"},
+	}
+	for _, c := range cases {
+		totp := TOTP{Digits: 8, Algorithm: c.algorithm}
+		secret := base32.StdEncoding.EncodeToString([]byte(secrets[c.algorithm]))
+		code, err := totp.Code(secret, time.Unix(c.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != c.code {
+			t.Errorf("%s at %d: expected %s, got %s", c.algorithm, c.unix, c.code, code)
+		}
+	}
+}
+
+func TestTOTPVerify(t *testing.T) {
+	totp := TOTP{Issuer: "efucloud"}
+	enrollment, err := totp.Enroll("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	previous, _ := totp.Code(enrollment.Secret, now.Add(-30*time.Second))
+	counter, err := totp.Verify(enrollment.Secret, previous, now, 0)
+	if err != nil {
+		t.Fatalf("expected code within drift window to pass, got: %v", err)
+	}
+	if _, err = totp.Verify(enrollment.Secret, previous, now, counter); !errors.Is(err, ErrCodeReplayed) {
+		t.Fatalf("expected replay to fail, got: %v", err)
+	}
+	old, _ := totp.Code(enrollment.Secret, now.Add(-2*time.Minute))
+	if _, err = totp.Verify(enrollment.Secret, old, now, 0); !errors.Is(err, ErrCodeInvalid) {
+		t.Fatalf("expected code outside drift window to fail, got: %v", err)
+	}
+
+	// period为秒数，与otpauth地址一致
+	custom := TOTP{Period: 60}
+	if uri, _ := custom.URI("admin", enrollment.Secret); !strings.Contains(uri, "period=60") {
+		t.Fatalf("unexpected uri: %s", uri)
+	}
+	first, _ := custom.Code(enrollment.Secret, time.Unix(60, 0))
+	second, _ := custom.Code(enrollment.Secret, time.Unix(119, 0))
+	if first != second {
+		t.Fatal("expected codes in the same period to be equal")
+	}
+
+	remaining, err := UseRecoveryCode(enrollment.RecoveryCodes[0], enrollment.RecoveryCodeHashes)
+	if err != nil || len(remaining) != DefaultRecoveryCodeCount-1 {
+		t.Fatalf("expected recovery code accepted, got: %v", err)
+	}
+	if _, err = UseRecoveryCode(enrollment.RecoveryCodes[0], remaining); !errors.Is(err, ErrCodeInvalid) {
+		t.Fatalf("expected used recovery code rejected, got: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/emicklei/go-restful/v3"
+	"math"
+)
+
+const (
+	PaginationOverflowClamp  = "clamp"
+	PaginationOverflowReject = "reject"
+	MsgCodeInvalidPagination = "invalidPagination"
+)
+
+var ErrPaginationOverflow = errors.New("pagination overflow")
+
+// PaginationPolicy 分页策略，Overflow为clamp时超出限制的参数会被截断，为reject时返回错误
+type PaginationPolicy struct {
+	DefaultPageSize int    `json:"defaultPageSize" yaml:"defaultPageSize" description:"默认每页数量"`
+	MaxPageSize     int    `json:"maxPageSize" yaml:"maxPageSize" description:"每页最大数量"`
+	MaxOffset       int    `json:"maxOffset" yaml:"maxOffset" description:"最大偏移量，0表示不限制"`
+	Overflow        string `json:"overflow" yaml:"overflow" validate:"omitempty,oneof=clamp reject" description:"超出限制时的处理方式"`
+}
+
+// DefaultPaginationPolicy GetRequestPaginationInformation 及 BindListQuery 使用的分页策略
+var DefaultPaginationPolicy = PaginationPolicy{
+	DefaultPageSize: DefaultPageSize,
+	MaxPageSize:     DefaultMaxPageSize,
+	Overflow:        PaginationOverflowClamp,
+}
+
+// Pagination 分页信息，Offset和Limit可以直接用于数据库查询
+type Pagination struct {
+	Current  int `json:"current"`
+	PageSize int `json:"pageSize"`
+	Offset   int `json:"offset"`
+	Limit    int `json:"limit"`
+}
+
+// Apply 根据策略校验分页参数并计算Offset和Limit
+func (p PaginationPolicy) Apply(current, pageSize int) (page Pagination, err error) {
+	if p.DefaultPageSize < 1 {
+		p.DefaultPageSize = DefaultPageSize
+	}
+	if p.MaxPageSize < 1 {
+		p.MaxPageSize = DefaultMaxPageSize
+	}
+	if current < 1 {
+		current = DefaultPage
+	}
+	if pageSize < 1 {
+		pageSize = p.DefaultPageSize
+	}
+	if pageSize > p.MaxPageSize {
+		if p.Overflow == PaginationOverflowReject {
+			return page, fmt.Errorf("%w: pageSize %d exceeds %d", ErrPaginationOverflow, pageSize, p.MaxPageSize)
+		}
+		pageSize = p.MaxPageSize
+	}
+	// 使用除法比较，避免current过大时(current-1)*pageSize溢出
+	maxOffset := p.MaxOffset
+	if maxOffset < 1 {
+		maxOffset = math.MaxInt
+	}
+	if current-1 > maxOffset/pageSize {
+		if p.Overflow == PaginationOverflowReject {
+			return page, fmt.Errorf("%w: current %d with pageSize %d exceeds offset %d", ErrPaginationOverflow, current, pageSize, maxOffset)
+		}
+		current = maxOffset/pageSize + 1
+	}
+	page.Current = current
+	page.PageSize = pageSize
+	page.Offset = (current - 1) * pageSize
+	page.Limit = pageSize
+	return page, nil
+}
+
+// GetRequestPagination 根据分页策略解析请求中的current和pageSize参数
+func GetRequestPagination(req *restful.Request, policy PaginationPolicy) (page Pagination, errData ErrorData) {
+	errData.Lang = GetLanguageFromReq(req, RequestLanguageKey)
+	page, err := policy.Apply(String2Int(req.QueryParameter("current"), DefaultPage),
+		String2Int(req.QueryParameter("pageSize"), policy.DefaultPageSize))
+	if err != nil {
+		errData = ErrCodeInvalidPagination.New(err,
+			map[string]interface{}{"maxPageSize": policy.MaxPageSize, "maxOffset": policy.MaxOffset}).ErrorData(errData.Lang)
+	}
+	return page, errData
+}
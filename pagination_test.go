@@ -0,0 +1,52 @@
+package common
+
+import (
+	"errors"
+	"math"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+func TestPaginationPolicy(t *testing.T) {
+	clamp := PaginationPolicy{DefaultPageSize: 10, MaxPageSize: 50, MaxOffset: 1000, Overflow: PaginationOverflowClamp}
+	reject := clamp
+	reject.Overflow = PaginationOverflowReject
+	cases := []struct {
+		policy            PaginationPolicy
+		current, pageSize int
+		page              Pagination
+		err               error
+	}{
+		{policy: clamp, current: 0, pageSize: 0, page: Pagination{Current: 1, PageSize: 10, Offset: 0, Limit: 10}},
+		{policy: clamp, current: 3, pageSize: 100, page: Pagination{Current: 3, PageSize: 50, Offset: 100, Limit: 50}},
+		{policy: clamp, current: 200, pageSize: 10, page: Pagination{Current: 101, PageSize: 10, Offset: 1000, Limit: 10}},
+		{policy: clamp, current: math.MaxInt, pageSize: 50, page: Pagination{Current: 21, PageSize: 50, Offset: 1000, Limit: 50}},
+		{policy: reject, current: 1, pageSize: 100, err: ErrPaginationOverflow},
+		{policy: reject, current: math.MaxInt/10 + 2, pageSize: 10, err: ErrPaginationOverflow},
+		{policy: PaginationPolicy{Overflow: PaginationOverflowReject}, current: math.MaxInt, pageSize: 10, err: ErrPaginationOverflow},
+	}
+	for _, c := range cases {
+		page, err := c.policy.Apply(c.current, c.pageSize)
+		if !errors.Is(err, c.err) {
+			t.Fatalf("current: %d, pageSize: %d, err: %v, expected: %v", c.current, c.pageSize, err, c.err)
+		}
+		if err == nil && page != c.page {
+			t.Fatalf("current: %d, pageSize: %d, page: %+v, expected: %+v", c.current, c.pageSize, page, c.page)
+		}
+	}
+	page, _ := PaginationPolicy{}.Apply(math.MaxInt, 10)
+	if page.Offset < 0 {
+		t.Fatalf("offset overflow: %+v", page)
+	}
+}
+
+func TestGetRequestPagination(t *testing.T) {
+	req := restful.NewRequest(httptest.NewRequest("GET", "/?current="+strconv.Itoa(math.MaxInt)+"&pageSize=10", nil))
+	policy := PaginationPolicy{MaxOffset: 100, Overflow: PaginationOverflowReject}
+	if _, errData := GetRequestPagination(req, policy); !errors.Is(errData.Err, ErrCodeInvalidPagination) || errData.ResponseCode != 400 {
+		t.Fatalf("expected invalid pagination, got: %v", errData.Err)
+	}
+}
@@ -0,0 +1,524 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	PasswordAlgorithmArgon2id = "argon2id"
+	PasswordAlgorithmScrypt   = "scrypt"
+	PasswordAlgorithmBcrypt   = "bcrypt"
+)
+
+const (
+	MsgCodePasswordTooShort          = "passwordTooShort"
+	MsgCodePasswordTooLong           = "passwordTooLong"
+	MsgCodePasswordRequireUpper      = "passwordRequireUpper"
+	MsgCodePasswordRequireLower      = "passwordRequireLower"
+	MsgCodePasswordRequireDigit      = "passwordRequireDigit"
+	MsgCodePasswordRequireSymbol     = "passwordRequireSymbol"
+	MsgCodePasswordCharClasses       = "passwordCharClasses"
+	MsgCodePasswordInDictionary      = "passwordInDictionary"
+	MsgCodePasswordSimilarToUsername = "passwordSimilarToUsername"
+	MsgCodePasswordReused            = "passwordReused"
+	MsgCodePasswordBreached          = "passwordBreached"
+)
+
+var (
+	ErrCodePasswordTooShort          = RegisterErrorCode(ErrorCode{Code: MsgCodePasswordTooShort, Status: http.StatusBadRequest, Params: []string{"min"}})
+	ErrCodePasswordTooLong           = RegisterErrorCode(ErrorCode{Code: MsgCodePasswordTooLong, Status: http.StatusBadRequest, Params: []string{"max"}})
+	ErrCodePasswordRequireUpper      = RegisterErrorCode(ErrorCode{Code: MsgCodePasswordRequireUpper, Status: http.StatusBadRequest})
+	ErrCodePasswordRequireLower      = RegisterErrorCode(ErrorCode{Code: MsgCodePasswordRequireLower, Status: http.StatusBadRequest})
+	ErrCodePasswordRequireDigit      = RegisterErrorCode(ErrorCode{Code: MsgCodePasswordRequireDigit, Status: http.StatusBadRequest})
+	ErrCodePasswordRequireSymbol     = RegisterErrorCode(ErrorCode{Code: MsgCodePasswordRequireSymbol, Status: http.StatusBadRequest})
+	ErrCodePasswordCharClasses       = RegisterErrorCode(ErrorCode{Code: MsgCodePasswordCharClasses, Status: http.StatusBadRequest, Params: []string{"min"}})
+	ErrCodePasswordInDictionary      = RegisterErrorCode(ErrorCode{Code: MsgCodePasswordInDictionary, Status: http.StatusBadRequest})
+	ErrCodePasswordSimilarToUsername = RegisterErrorCode(ErrorCode{Code: MsgCodePasswordSimilarToUsername, Status: http.StatusBadRequest})
+	ErrCodePasswordReused            = RegisterErrorCode(ErrorCode{Code: MsgCodePasswordReused, Status: http.StatusBadRequest, Params: []string{"count"}})
+	ErrCodePasswordBreached          = RegisterErrorCode(ErrorCode{Code: MsgCodePasswordBreached, Status: http.StatusBadRequest})
+)
+
+var (
+	ErrPasswordMismatch         = errors.New("username or password is not right")
+	ErrPasswordHashInvalid      = errors.New("password hash is invalid")
+	ErrPasswordAlgorithmUnknown = errors.New("password hash algorithm not supported")
+)
+
+// DefaultPasswordDictionary 常见弱密码，比较时忽略大小写及末尾的数字、符号
+var DefaultPasswordDictionary = []string{
+	"password", "passw0rd", "123456", "12345678", "123456789", "1234567890", "qwerty", "qwertyuiop",
+	"abc123", "111111", "000000", "letmein", "welcome", "admin", "administrator", "root", "iloveyou",
+	"monkey", "dragon", "football", "baseball", "sunshine", "master", "login", "changeme", "secret",
+}
+
+// PasswordPolicy 密码策略，零值字段表示不校验
+type PasswordPolicy struct {
+	MinLength      int      `json:"minLength" yaml:"minLength" description:"最小长度"`
+	MaxLength      int      `json:"maxLength" yaml:"maxLength" description:"最大长度"`
+	RequireUpper   bool     `json:"requireUpper" yaml:"requireUpper" description:"必须包含大写字母"`
+	RequireLower   bool     `json:"requireLower" yaml:"requireLower" description:"必须包含小写字母"`
+	RequireDigit   bool     `json:"requireDigit" yaml:"requireDigit" description:"必须包含数字"`
+	RequireSymbol  bool     `json:"requireSymbol" yaml:"requireSymbol" description:"必须包含特殊字符"`
+	MinCharClasses int      `json:"minCharClasses" yaml:"minCharClasses" description:"大写、小写、数字、特殊字符中至少包含的种类"`
+	Dictionary     []string `json:"dictionary" yaml:"dictionary" description:"禁止使用的弱密码"`
+	// MaxUsernameSimilarity 密码与用户名的相似度（0-1）不能超过该值，包含用户名视为1，0表示不校验
+	MaxUsernameSimilarity float64 `json:"maxUsernameSimilarity" yaml:"maxUsernameSimilarity" description:"与用户名的最大相似度"`
+	HistorySize           int     `json:"historySize" yaml:"historySize" description:"不能与最近N次的密码相同"`
+	// Breach 检查密码是否已经泄露，为空时不检查
+	Breach BreachChecker `json:"-" yaml:"-"`
+}
+
+// DefaultPasswordPolicy 至少8位，包含3种字符，不能使用弱密码及与用户名相似，不能与最近5次密码相同
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:             8,
+		MaxLength:             128,
+		MinCharClasses:        3,
+		Dictionary:            DefaultPasswordDictionary,
+		MaxUsernameSimilarity: 0.7,
+		HistorySize:           5,
+	}
+}
+
+// PasswordPolicyError 密码不满足策略，包含所有不满足的规则
+type PasswordPolicyError struct {
+	Violations []*AppError
+}
+
+func (e *PasswordPolicyError) Error() string {
+	codes := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		codes = append(codes, violation.Code.Code)
+	}
+	return "password policy violated: " + strings.Join(codes, ",")
+}
+
+// Unwrap 支持errors.Is(err, ErrCodePasswordTooShort)等
+func (e *PasswordPolicyError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		errs = append(errs, violation)
+	}
+	return errs
+}
+
+// ErrorData 使用第一条不满足的规则作为响应信息
+func (e *PasswordPolicyError) ErrorData(lang string) ErrorData {
+	data := e.Violations[0].ErrorData(lang)
+	data.Err = e
+	return data
+}
+
+// Messages 所有不满足规则的本地化信息
+func (e *PasswordPolicyError) Messages(bundle *i18n.Bundle, lang string) (messages []string) {
+	for _, violation := range e.Violations {
+		msg, _ := GetLocaleMessage(bundle, violation.Params, lang, violation.Code.MessageID)
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// Validate 校验密码，history为最近使用过的密码哈希，最新的在前，salt为账号的盐，用于比较GeneratePassword生成的旧哈希，
+// 不满足时返回*PasswordPolicyError
+func (p PasswordPolicy) Validate(ctx context.Context, password, username, salt string, history ...string) error {
+	var violations []*AppError
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		violations = append(violations, ErrCodePasswordTooShort.New(nil, map[string]interface{}{"min": p.MinLength}))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, ErrCodePasswordTooLong.New(nil, map[string]interface{}{"max": p.MaxLength}))
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	for _, rule := range []struct {
+		required, matched bool
+		code              *ErrorCode
+	}{
+		{p.RequireUpper, upper, ErrCodePasswordRequireUpper},
+		{p.RequireLower, lower, ErrCodePasswordRequireLower},
+		{p.RequireDigit, digit, ErrCodePasswordRequireDigit},
+		{p.RequireSymbol, symbol, ErrCodePasswordRequireSymbol},
+	} {
+		if rule.required && !rule.matched {
+			violations = append(violations, rule.code.New(nil, nil))
+		}
+	}
+	classes := 0
+	for _, matched := range []bool{upper, lower, digit, symbol} {
+		if matched {
+			classes++
+		}
+	}
+	if p.MinCharClasses > 0 && classes < p.MinCharClasses {
+		violations = append(violations, ErrCodePasswordCharClasses.New(nil, map[string]interface{}{"min": p.MinCharClasses}))
+	}
+	if inPasswordDictionary(password, p.Dictionary) {
+		violations = append(violations, ErrCodePasswordInDictionary.New(nil, nil))
+	}
+	if p.MaxUsernameSimilarity > 0 && PasswordSimilarity(password, username) > p.MaxUsernameSimilarity {
+		violations = append(violations, ErrCodePasswordSimilarToUsername.New(nil, nil))
+	}
+	if p.HistorySize > 0 {
+		if len(history) > p.HistorySize {
+			history = history[:p.HistorySize]
+		}
+		for _, encoded := range history {
+			if _, err := DefaultPasswordHasher.Verify(encoded, password, salt); err == nil {
+				violations = append(violations, ErrCodePasswordReused.New(nil, map[string]interface{}{"count": p.HistorySize}))
+				break
+			}
+		}
+	}
+	if p.Breach != nil && len(violations) == 0 {
+		breached, err := p.Breach.Breached(ctx, password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, ErrCodePasswordBreached.New(nil, nil))
+		}
+	}
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func inPasswordDictionary(password string, dictionary []string) bool {
+	lower := strings.ToLower(password)
+	trimmed := strings.TrimRightFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, item := range dictionary {
+		item = strings.ToLower(item)
+		if lower == item || trimmed == item {
+			return true
+		}
+	}
+	return false
+}
+
+// PasswordSimilarity 密码与用户名的相似度，忽略大小写，密码包含用户名（或倒序）时为1，否则为1-编辑距离/较长的长度
+func PasswordSimilarity(password, username string) float64 {
+	password, username = strings.ToLower(password), strings.ToLower(username)
+	if utf8.RuneCountInString(username) < 3 || len(password) == 0 {
+		return 0
+	}
+	reversed := []rune(username)
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+	if strings.Contains(password, username) || strings.Contains(password, string(reversed)) {
+		return 1
+	}
+	a, b := []rune(password), []rune(username)
+	longest := len(a)
+	if len(b) > longest {
+		longest = len(b)
+	}
+	return 1 - float64(levenshtein(a, b))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// BreachChecker 检查密码是否出现在已泄露的密码库中
+type BreachChecker interface {
+	Breached(ctx context.Context, password string) (bool, error)
+}
+
+// PwnedPasswords 使用Have I Been Pwned的k-anonymity接口，只发送SHA1的前5位
+type PwnedPasswords struct {
+	Endpoint string // 默认https://api.pwnedpasswords.com/range/
+	Client   *http.Client
+}
+
+func (p PwnedPasswords) Breached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	endpoint := p.Endpoint
+	if len(endpoint) == 0 {
+		endpoint = "https://api.pwnedpasswords.com/range/"
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+hash[:5], nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Add-Padding", "true")
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("check pwned password failed, err: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("check pwned password failed, status: %d", resp.StatusCode)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		suffix, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if suffix == hash[5:] && count != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// PasswordHasher 密码哈希，生成的哈希中记录算法及参数：
+// argon2id: $argon2id$v=19$m=65536,t=3,p=2$salt$hash
+// scrypt:   $scrypt$ln=15,r=8,p=1$salt$hash
+// bcrypt:   $2a$12$...
+type PasswordHasher struct {
+	Algorithm string `json:"algorithm" yaml:"algorithm" description:"哈希算法，argon2id/scrypt/bcrypt"`
+	// argon2id参数
+	Argon2Memory      uint32 `json:"argon2Memory" yaml:"argon2Memory" description:"内存，单位KiB"`
+	Argon2Iterations  uint32 `json:"argon2Iterations" yaml:"argon2Iterations" description:"迭代次数"`
+	Argon2Parallelism uint8  `json:"argon2Parallelism" yaml:"argon2Parallelism" description:"并行度"`
+	// scrypt参数，N=2^ScryptLogN
+	ScryptLogN int `json:"scryptLogN" yaml:"scryptLogN" description:"CPU/内存开销的对数"`
+	ScryptR    int `json:"scryptR" yaml:"scryptR" description:"块大小"`
+	ScryptP    int `json:"scryptP" yaml:"scryptP" description:"并行度"`
+	BcryptCost int `json:"bcryptCost" yaml:"bcryptCost" description:"bcrypt开销"`
+}
+
+// DefaultPasswordHasher 默认使用argon2id，参数参考OWASP建议，PasswordHasher中为零的参数使用该默认值
+var DefaultPasswordHasher = PasswordHasher{
+	Algorithm:         PasswordAlgorithmArgon2id,
+	Argon2Memory:      64 * 1024,
+	Argon2Iterations:  3,
+	Argon2Parallelism: 2,
+	ScryptLogN:        15,
+	ScryptR:           8,
+	ScryptP:           1,
+	BcryptCost:        12,
+}
+
+const passwordSaltLength = 16
+const passwordKeyLength = 32
+
+var passwordEncoding = base64.RawStdEncoding
+
+// withDefaults 为零的参数使用DefaultPasswordHasher的值，避免argon2、scrypt因参数为0而panic或者报错
+func (h PasswordHasher) withDefaults() PasswordHasher {
+	if len(h.Algorithm) == 0 {
+		h.Algorithm = DefaultPasswordHasher.Algorithm
+	}
+	if h.Argon2Memory == 0 {
+		h.Argon2Memory = DefaultPasswordHasher.Argon2Memory
+	}
+	if h.Argon2Iterations == 0 {
+		h.Argon2Iterations = DefaultPasswordHasher.Argon2Iterations
+	}
+	if h.Argon2Parallelism == 0 {
+		h.Argon2Parallelism = DefaultPasswordHasher.Argon2Parallelism
+	}
+	if h.ScryptLogN <= 1 {
+		h.ScryptLogN = DefaultPasswordHasher.ScryptLogN
+	}
+	if h.ScryptR <= 0 {
+		h.ScryptR = DefaultPasswordHasher.ScryptR
+	}
+	if h.ScryptP <= 0 {
+		h.ScryptP = DefaultPasswordHasher.ScryptP
+	}
+	if h.BcryptCost == 0 {
+		h.BcryptCost = DefaultPasswordHasher.BcryptCost
+	}
+	return h
+}
+
+// Hash 生成记录算法及参数的密码哈希
+func (h PasswordHasher) Hash(password string) (string, error) {
+	h = h.withDefaults()
+	salt := make([]byte, passwordSaltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", err
+	}
+	switch h.Algorithm {
+	case PasswordAlgorithmArgon2id:
+		key := argon2.IDKey([]byte(password), salt, h.Argon2Iterations, h.Argon2Memory, h.Argon2Parallelism, passwordKeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Argon2Memory, h.Argon2Iterations, h.Argon2Parallelism,
+			passwordEncoding.EncodeToString(salt), passwordEncoding.EncodeToString(key)), nil
+	case PasswordAlgorithmScrypt:
+		key, err := scrypt.Key([]byte(password), salt, 1<<h.ScryptLogN, h.ScryptR, h.ScryptP, passwordKeyLength)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", h.ScryptLogN, h.ScryptR, h.ScryptP,
+			passwordEncoding.EncodeToString(salt), passwordEncoding.EncodeToString(key)), nil
+	case PasswordAlgorithmBcrypt:
+		// 超过72字节时bcrypt返回ErrPasswordTooLong，不会静默截断
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+	return "", ErrPasswordAlgorithmUnknown
+}
+
+// Verify 校验密码，salt仅用于GeneratePassword生成的旧哈希（bcrypt(password+salt)），
+// 校验成功且哈希算法、参数与当前配置不一致或者为旧哈希时rehash为true，调用方应使用Hash重新生成并保存
+func (h PasswordHasher) Verify(encoded, password, salt string) (rehash bool, err error) {
+	algorithm, params, saltValue, key, err := parsePasswordHash(encoded)
+	if err != nil {
+		return false, err
+	}
+	switch algorithm {
+	case PasswordAlgorithmBcrypt:
+		// 旧哈希大多为GeneratePassword生成，先比较加盐的形式，正常登录只需要计算一次bcrypt
+		if len(salt) > 0 && bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password+salt)) == nil {
+			return true, nil
+		}
+		if bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil {
+			return h.NeedsRehash(encoded), nil
+		}
+		return false, ErrPasswordMismatch
+	case PasswordAlgorithmArgon2id:
+		actual := argon2.IDKey([]byte(password), saltValue, uint32(params["t"]), uint32(params["m"]), uint8(params["p"]), uint32(len(key)))
+		if subtle.ConstantTimeCompare(actual, key) != 1 {
+			return false, ErrPasswordMismatch
+		}
+	case PasswordAlgorithmScrypt:
+		actual, err := scrypt.Key([]byte(password), saltValue, 1<<params["ln"], params["r"], params["p"], len(key))
+		if err != nil {
+			return false, err
+		}
+		if subtle.ConstantTimeCompare(actual, key) != 1 {
+			return false, ErrPasswordMismatch
+		}
+	}
+	return h.NeedsRehash(encoded), nil
+}
+
+// NeedsRehash 哈希的算法或者参数与当前配置不一致
+func (h PasswordHasher) NeedsRehash(encoded string) bool {
+	algorithm, params, _, _, err := parsePasswordHash(encoded)
+	if err != nil {
+		return true
+	}
+	h = h.withDefaults()
+	if algorithm != h.Algorithm {
+		return true
+	}
+	switch algorithm {
+	case PasswordAlgorithmArgon2id:
+		return params["m"] != int(h.Argon2Memory) || params["t"] != int(h.Argon2Iterations) || params["p"] != int(h.Argon2Parallelism)
+	case PasswordAlgorithmScrypt:
+		return params["ln"] != h.ScryptLogN || params["r"] != h.ScryptR || params["p"] != h.ScryptP
+	case PasswordAlgorithmBcrypt:
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost != h.BcryptCost
+	}
+	return true
+}
+
+func parsePasswordHash(encoded string) (algorithm string, params map[string]int, salt, key []byte, err error) {
+	if strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$") {
+		return PasswordAlgorithmBcrypt, nil, nil, nil, nil
+	}
+	parts := strings.Split(encoded, "$")
+	params = make(map[string]int)
+	switch {
+	case len(parts) == 6 && parts[1] == PasswordAlgorithmArgon2id:
+		if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+			return "", nil, nil, nil, ErrPasswordAlgorithmUnknown
+		}
+		parts = append(parts[:2], parts[3:]...)
+	case len(parts) == 5 && parts[1] == PasswordAlgorithmScrypt:
+	default:
+		return "", nil, nil, nil, ErrPasswordHashInvalid
+	}
+	algorithm = parts[1]
+	for _, item := range strings.Split(parts[2], ",") {
+		var name string
+		var value int
+		if n, _ := fmt.Sscanf(strings.Replace(item, "=", " ", 1), "%s %d", &name, &value); n != 2 || value <= 0 {
+			return "", nil, nil, nil, ErrPasswordHashInvalid
+		}
+		params[name] = value
+	}
+	if salt, err = passwordEncoding.DecodeString(parts[3]); err != nil {
+		return "", nil, nil, nil, ErrPasswordHashInvalid
+	}
+	if key, err = passwordEncoding.DecodeString(parts[4]); err != nil || len(key) == 0 {
+		return "", nil, nil, nil, ErrPasswordHashInvalid
+	}
+	for _, name := range map[string][]string{
+		PasswordAlgorithmArgon2id: {"m", "t", "p"},
+		PasswordAlgorithmScrypt:   {"ln", "r", "p"},
+	}[algorithm] {
+		if _, exist := params[name]; !exist {
+			return "", nil, nil, nil, ErrPasswordHashInvalid
+		}
+	}
+	if algorithm == PasswordAlgorithmArgon2id && params["p"] > 255 {
+		return "", nil, nil, nil, ErrPasswordHashInvalid
+	}
+	return algorithm, params, salt, key, nil
+}
@@ -0,0 +1,81 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPasswordHasherRehash(t *testing.T) {
+	legacy, err := GeneratePassword("Tr0ub4dor&3x", "salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rehash, err := DefaultPasswordHasher.Verify(legacy, "Tr0ub4dor&3x", "salt"); err != nil || !rehash {
+		t.Fatalf("legacy hash: rehash %v, err: %v", rehash, err)
+	}
+	encoded, err := DefaultPasswordHasher.Hash("Tr0ub4dor&3x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rehash, err := DefaultPasswordHasher.Verify(encoded, "Tr0ub4dor&3x", ""); err != nil || rehash {
+		t.Fatalf("argon2id hash: rehash %v, err: %v", rehash, err)
+	}
+	if err = ComparePassword(encoded, "wrong", ""); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("expected mismatch, got %v", err)
+	}
+	scrypt := DefaultPasswordHasher
+	scrypt.Algorithm = PasswordAlgorithmScrypt
+	if !scrypt.NeedsRehash(encoded) {
+		t.Fatal("argon2id hash should be rehashed by scrypt hasher")
+	}
+}
+
+func TestPasswordHasherDefaults(t *testing.T) {
+	for _, hasher := range []PasswordHasher{{}, {Algorithm: PasswordAlgorithmArgon2id, Argon2Memory: 8 * 1024},
+		{Algorithm: PasswordAlgorithmScrypt, ScryptR: 8}} {
+		encoded, err := hasher.Hash("Tr0ub4dor&3x")
+		if err != nil {
+			t.Fatalf("%+v: %v", hasher, err)
+		}
+		if rehash, err := hasher.Verify(encoded, "Tr0ub4dor&3x", ""); err != nil || rehash {
+			t.Fatalf("%+v: rehash %v, err: %v", hasher, rehash, err)
+		}
+	}
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	history, _ := DefaultPasswordHasher.Hash("Tr0ub4dor&3x")
+	legacy, _ := GeneratePassword("Tr0ub4dor&3x", "s1")
+	cases := []struct {
+		password, username, salt string
+		history                  []string
+		expected                 []*ErrorCode
+	}{
+		{password: "Tr0ub4dor&3x", username: "alice"},
+		{password: "Tr0ub4dor&3x", username: "alice", history: []string{history}, expected: []*ErrorCode{ErrCodePasswordReused}},
+		{password: "Tr0ub4dor&3x", username: "alice", salt: "s1", history: []string{legacy}, expected: []*ErrorCode{ErrCodePasswordReused}},
+		{password: "Ab1", username: "alice", expected: []*ErrorCode{ErrCodePasswordTooShort}},
+		{password: "Password123!", username: "alice", expected: []*ErrorCode{ErrCodePasswordInDictionary}},
+		{password: "alice2024", username: "alice", expected: []*ErrorCode{ErrCodePasswordCharClasses, ErrCodePasswordSimilarToUsername}},
+	}
+	for _, c := range cases {
+		err := policy.Validate(context.Background(), c.password, c.username, c.salt, c.history...)
+		if len(c.expected) == 0 {
+			if err != nil {
+				t.Fatalf("%s: unexpected err: %v", c.password, err)
+			}
+			continue
+		}
+		var policyErr *PasswordPolicyError
+		if !errors.As(err, &policyErr) || len(policyErr.Violations) != len(c.expected) {
+			t.Fatalf("%s: err: %v, expected: %v", c.password, err, c.expected)
+		}
+		for _, code := range c.expected {
+			if !errors.Is(err, code) {
+				t.Fatalf("%s: err: %v, expected: %s", c.password, err, code)
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"github.com/emicklei/go-restful/v3"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"mime"
+	"net/http"
+	"runtime"
+	"strings"
+)
+
+const MIMEProblemJSON = "application/problem+json"
+
+var (
+	// ResponseErrorDebug 开启后problem+json响应中包含内部错误信息及调用的源码位置，生产环境不应开启
+	ResponseErrorDebug = false
+	// ProblemTypeBaseURI 不为空时problem+json的type为 ProblemTypeBaseURI + MsgCode，否则为about:blank
+	ProblemTypeBaseURI = ""
+)
+
+// ProblemDetails RFC 7807 错误响应
+type ProblemDetails struct {
+	Type      string           `json:"type" description:"错误类型"`
+	Title     string           `json:"title" description:"错误标题"`
+	Status    int              `json:"status" description:"响应码"`
+	Detail    string           `json:"detail,omitempty" description:"错误详情信息，调试模式下为内部错误信息"`
+	Instance  string           `json:"instance,omitempty" description:"当前请求地址"`
+	MsgCode   string           `json:"msgCode,omitempty" description:"错误英文编码"`
+	Alert     string           `json:"alert,omitempty" description:"支持I18N的提示信息"`
+	Errors    FiledValidFailed `json:"errors,omitempty" description:"字段校验失败信息"`
+	RequestID string           `json:"requestId,omitempty" description:"请求ID"`
+	Links     []ErrorSource    `json:"links,omitempty" description:"调试模式下的源码位置"`
+}
+
+// AcceptProblemJSON 请求的Accept头中是否包含application/problem+json，
+// 路由的Produces中没有application/problem+json时客户端需要同时接受application/json，否则go-restful会返回406
+func AcceptProblemJSON(req *restful.Request) bool {
+	for _, item := range strings.Split(req.Request.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(item)); err == nil && mediaType == MIMEProblemJSON {
+			return true
+		}
+	}
+	return false
+}
+
+// ResponseProblem 以application/problem+json格式返回错误信息，detail未设置语言时使用ctx中的语言
+func ResponseProblem(ctx context.Context, req *restful.Request, resp *restful.Response, bundle *i18n.Bundle, detail ErrorData) {
+	writeProblem(ctx, req, resp, bundle, detail, 2)
+}
+
+func writeProblem(ctx context.Context, req *restful.Request, resp *restful.Response, bundle *i18n.Bundle, detail ErrorData, skip int) {
+	if detail.ResponseCode == 0 {
+		detail.ResponseCode = http.StatusInternalServerError
+	}
+	if len(detail.Lang) == 0 && ctx != nil {
+		detail.Lang = GetLangFromCtx(ctx, RequestLanguageKey)
+	}
+	resp.Header().Add("X-Content-Type-Options", "nosniff")
+	resp.Header().Add("X-XSS-Protection", "1; mode=block")
+	body := ProblemDetails{
+		Type:      "about:blank",
+		Title:     http.StatusText(detail.ResponseCode),
+		Status:    detail.ResponseCode,
+		Instance:  req.Request.RequestURI,
+		MsgCode:   detail.MsgCode,
+		Errors:    detail.Fields,
+		RequestID: GetRequestID(req),
+	}
+	if len(body.RequestID) == 0 && ctx != nil {
+		body.RequestID = GetRequestIDFromCtx(ctx)
+	}
+	if len(ProblemTypeBaseURI) > 0 && len(detail.MsgCode) > 0 {
+		body.Type = URL(ProblemTypeBaseURI, detail.MsgCode)
+	}
+	if len(detail.MsgCode) > 0 {
+		body.Alert, _ = GetLocaleMessage(bundle, detail.Params, detail.Lang, detail.MsgCode)
+	}
+	// 内部错误信息可能包含SQL、路径等敏感信息，只在调试模式下返回
+	body.Detail = body.Alert
+	if ResponseErrorDebug {
+		if detail.Err != nil {
+			body.Detail = detail.Err.Error()
+		}
+		body.Links = errorSources(skip + 1)
+	}
+	_ = resp.WriteHeaderAndJson(detail.ResponseCode, body, MIMEProblemJSON)
+}
+
+// errorSources 获取调用栈中的源码位置，skip为跳过的调用层级
+func errorSources(skip int) (links []ErrorSource) {
+	for depth := skip; depth < skip+5; depth++ {
+		_, file, line, ok := runtime.Caller(depth)
+		if !ok {
+			break
+		}
+		links = append(links, ErrorSource{File: file, Line: line})
+	}
+	return links
+}
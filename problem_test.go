@@ -0,0 +1,75 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emicklei/go-restful/v3"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+func TestAcceptProblemJSON(t *testing.T) {
+	cases := map[string]bool{
+		"":                         false,
+		"application/json":         false,
+		"application/problem+json": true,
+		"application/json, application/problem+json;q=0.9": true,
+		"text/html, application/problem+jsonx":             false,
+	}
+	for accept, expected := range cases {
+		r := httptest.NewRequest("GET", "/users", nil)
+		r.Header.Set("Accept", accept)
+		if AcceptProblemJSON(restful.NewRequest(r)) != expected {
+			t.Fatalf("%q: expected %v", accept, expected)
+		}
+	}
+}
+
+func TestResponseProblem(t *testing.T) {
+	bundle := i18n.NewBundle(language.Chinese)
+	_ = bundle.AddMessages(language.English, &i18n.Message{ID: "notFound", Other: "{{.resource}} {{.id}} not found"})
+	detail := NotFound("user", 1).ErrorData("")
+	detail.Err = errors.New("select * from users where id = 1: record not found")
+	ctx := context.WithValue(context.WithValue(context.Background(), RequestLanguageKey, "en"), RequestIDKey, "req-1")
+
+	write := func(debug bool, accept string) (*httptest.ResponseRecorder, ProblemDetails) {
+		ResponseErrorDebug = debug
+		defer func() { ResponseErrorDebug = false }()
+		r := httptest.NewRequest("GET", "/users/1", nil)
+		r.Header.Set("Accept", accept)
+		recorder := httptest.NewRecorder()
+		ResponseErrorMessage(ctx, restful.NewRequest(r), restful.NewResponse(recorder), bundle, detail)
+		var body ProblemDetails
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return recorder, body
+	}
+
+	recorder, body := write(false, MIMEProblemJSON)
+	if recorder.Code != http.StatusNotFound || recorder.Header().Get("Content-Type") != MIMEProblemJSON {
+		t.Fatalf("status: %d, content type: %s", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	if body.Type != "about:blank" || body.Title != "Not Found" || body.Status != http.StatusNotFound ||
+		body.Instance != "/users/1" || body.MsgCode != "notFound" || body.RequestID != "req-1" {
+		t.Fatalf("unexpected body: %+v", body)
+	}
+	if body.Alert != "user 1 not found" || body.Detail != body.Alert || len(body.Links) > 0 {
+		t.Fatalf("internal error leaked: %+v", body)
+	}
+
+	_, body = write(true, MIMEProblemJSON)
+	if body.Detail != detail.Err.Error() || len(body.Links) == 0 {
+		t.Fatalf("expected debug detail and links: %+v", body)
+	}
+
+	recorder, _ = write(false, "application/json")
+	if recorder.Header().Get("Content-Type") == MIMEProblemJSON {
+		t.Fatal("expected application/json response without problem+json accept")
+	}
+}
@@ -0,0 +1,355 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	ErrQueryFieldNotAllowed = errors.New("query field is not allowed")
+	ErrQueryInvalidOperator = errors.New("query operator is invalid")
+	ErrQueryInvalidValue    = errors.New("query value is invalid")
+)
+
+// QueryColumns 查询字段白名单，key为json字段名，value为数据库列名
+type QueryColumns map[string]string
+
+// NewQueryColumns 根据模型的json/gorm标签生成查询字段白名单
+// 列名优先使用gorm标签中的column，否则与RequestQuery一致使用CamelString2Snake(json字段名)
+func NewQueryColumns(model interface{}) (columns QueryColumns) {
+	columns = make(QueryColumns)
+	t := reflect.TypeOf(model)
+	if t == nil {
+		return
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	walkQueryFields(t, nil, func(name, column string, index []int) {
+		columns[name] = column
+	})
+	return
+}
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// walkQueryFields 遍历模型中可以作为查询条件的字段，index为字段在结构体中的位置
+func walkQueryFields(t reflect.Type, parent []int, fn func(name, column string, index []int)) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		index := append(append([]int{}, parent...), i)
+		gormSettings := parseGormTag(field.Tag.Get("gorm"))
+		if _, ignore := gormSettings["-"]; ignore {
+			continue
+		}
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && ft.Kind() == reflect.Struct {
+			walkQueryFields(ft, index, fn)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		// 关联关系字段不能作为查询条件
+		switch ft.Kind() {
+		case reflect.Struct, reflect.Slice, reflect.Map, reflect.Array:
+			if ft != timeType && !ft.Implements(valuerType) && !reflect.PointerTo(ft).Implements(valuerType) &&
+				!(ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Uint8) {
+				continue
+			}
+		}
+		column := gormSettings["column"]
+		if len(column) == 0 {
+			column = CamelString2Snake(name)
+		}
+		fn(name, column, index)
+	}
+}
+
+func parseGormTag(tag string) (settings map[string]string) {
+	settings = make(map[string]string)
+	for _, item := range strings.Split(tag, ";") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		kv := strings.SplitN(item, ":", 2)
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		if len(kv) == 2 {
+			settings[key] = strings.TrimSpace(kv[1])
+		} else {
+			settings[key] = ""
+		}
+	}
+	return
+}
+
+// Allow 添加允许查询的字段
+func (c QueryColumns) Allow(name, column string) QueryColumns {
+	if len(column) == 0 {
+		column = CamelString2Snake(name)
+	}
+	c[name] = column
+	return c
+}
+
+// Column 获取字段对应的列名，支持json字段名或者列名本身
+func (c QueryColumns) Column(name string) (column string, ok bool) {
+	if column, ok = c[name]; ok {
+		return column, ok
+	}
+	for _, v := range c {
+		if v == name {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// Build 将查询条件渲染为QueryParam，多个条件之间使用AND连接
+func (c QueryColumns) Build(filters ...*QueryFilter) (queryParam QueryParam, err error) {
+	queryParam.WhereQuery, queryParam.WhereArgs, err = c.render(FilterAnd(filters...))
+	if err != nil {
+		return QueryParam{}, err
+	}
+	return queryParam, nil
+}
+
+// QueryFilter 查询条件树，Logic不为空时为条件组，否则为字段条件
+type QueryFilter struct {
+	Logic    string         `json:"logic,omitempty"`    // and or not
+	Field    string         `json:"field,omitempty"`    // json字段名
+	Operator string         `json:"operator,omitempty"` // eq ne gt gte lt lte between like prefix in notIn isNull
+	Value    interface{}    `json:"value,omitempty"`
+	Filters  []*QueryFilter `json:"filters,omitempty"`
+}
+
+func FilterAnd(filters ...*QueryFilter) *QueryFilter {
+	return &QueryFilter{Logic: QueryLogicAnd, Filters: filters}
+}
+func FilterOr(filters ...*QueryFilter) *QueryFilter {
+	return &QueryFilter{Logic: QueryLogicOr, Filters: filters}
+}
+func FilterNot(filter *QueryFilter) *QueryFilter {
+	return &QueryFilter{Logic: QueryLogicNot, Filters: []*QueryFilter{filter}}
+}
+func FilterCondition(field, operator string, value interface{}) *QueryFilter {
+	return &QueryFilter{Field: field, Operator: operator, Value: value}
+}
+func FilterEq(field string, value interface{}) *QueryFilter {
+	return FilterCondition(field, QueryTypeEqual, value)
+}
+func FilterNe(field string, value interface{}) *QueryFilter {
+	return FilterCondition(field, QueryTypeNotEqual, value)
+}
+func FilterGt(field string, value interface{}) *QueryFilter {
+	return FilterCondition(field, QueryTypeGreater, value)
+}
+func FilterGte(field string, value interface{}) *QueryFilter {
+	return FilterCondition(field, QueryTypeGreaterEqual, value)
+}
+func FilterLt(field string, value interface{}) *QueryFilter {
+	return FilterCondition(field, QueryTypeLess, value)
+}
+func FilterLte(field string, value interface{}) *QueryFilter {
+	return FilterCondition(field, QueryTypeLessEqual, value)
+}
+func FilterBetween(field string, from, to interface{}) *QueryFilter {
+	return FilterCondition(field, QueryTypeBetween, []interface{}{from, to})
+}
+
+// FilterLike 模糊匹配，value中的 % _ 会被转义
+func FilterLike(field string, value string) *QueryFilter {
+	return FilterCondition(field, QueryTypeLike, value)
+}
+
+// FilterPrefix 前缀匹配，value中的 % _ 会被转义
+func FilterPrefix(field string, value string) *QueryFilter {
+	return FilterCondition(field, QueryTypePrefix, value)
+}
+
+// FilterIn values 需要为切片，切片为空时条件恒为假
+func FilterIn(field string, values interface{}) *QueryFilter {
+	return FilterCondition(field, QueryTypeIn, values)
+}
+
+// FilterNotIn values 需要为切片，切片为空时忽略该条件
+func FilterNotIn(field string, values interface{}) *QueryFilter {
+	return FilterCondition(field, QueryTypeNotIn, values)
+}
+func FilterIsNull(field string) *QueryFilter {
+	return FilterCondition(field, QueryTypeIsNull, true)
+}
+func FilterNotNull(field string) *QueryFilter {
+	return FilterCondition(field, QueryTypeIsNull, false)
+}
+
+func (c QueryColumns) render(filter *QueryFilter) (sql string, args []interface{}, err error) {
+	if filter == nil {
+		return "", nil, nil
+	}
+	switch filter.Logic {
+	case "":
+		return c.renderCondition(filter)
+	case QueryLogicAnd, QueryLogicOr:
+		var parts []string
+		for _, item := range filter.Filters {
+			s, a, er := c.render(item)
+			if er != nil {
+				return "", nil, er
+			}
+			if len(s) == 0 {
+				continue
+			}
+			parts = append(parts, s)
+			args = append(args, a...)
+		}
+		switch len(parts) {
+		case 0:
+			return "", nil, nil
+		case 1:
+			return parts[0], args, nil
+		}
+		return "(" + strings.Join(parts, " "+strings.ToUpper(filter.Logic)+" ") + ")", args, nil
+	case QueryLogicNot:
+		if len(filter.Filters) == 0 {
+			return "", nil, fmt.Errorf("%w: not requires at least one filter", ErrQueryInvalidValue)
+		}
+		s, a, er := c.render(FilterAnd(filter.Filters...))
+		if er != nil {
+			return "", nil, er
+		}
+		if len(s) == 0 {
+			// 内部条件恒为真（如空的notIn），取反后恒为假
+			return "1 = 0", nil, nil
+		}
+		return "NOT (" + s + ")", a, nil
+	}
+	return "", nil, fmt.Errorf("%w: logic %s", ErrQueryInvalidOperator, filter.Logic)
+}
+
+func (c QueryColumns) renderCondition(filter *QueryFilter) (sql string, args []interface{}, err error) {
+	column, ok := c.Column(filter.Field)
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrQueryFieldNotAllowed, filter.Field)
+	}
+	switch filter.Operator {
+	case QueryTypeEqual, "":
+		if filter.Value == nil {
+			return column + " IS NULL", nil, nil
+		}
+		return column + " = ?", []interface{}{filter.Value}, nil
+	case QueryTypeNotEqual:
+		if filter.Value == nil {
+			return column + " IS NOT NULL", nil, nil
+		}
+		return column + " <> ?", []interface{}{filter.Value}, nil
+	case QueryTypeGreater:
+		return column + " > ?", []interface{}{filter.Value}, nil
+	case QueryTypeGreaterEqual:
+		return column + " >= ?", []interface{}{filter.Value}, nil
+	case QueryTypeLess:
+		return column + " < ?", []interface{}{filter.Value}, nil
+	case QueryTypeLessEqual:
+		return column + " <= ?", []interface{}{filter.Value}, nil
+	case QueryTypeBetween:
+		values, ok := sliceValues(filter.Value)
+		if !ok || len(values) != 2 {
+			return "", nil, fmt.Errorf("%w: %s between requires two values", ErrQueryInvalidValue, filter.Field)
+		}
+		return column + " BETWEEN ? AND ?", values, nil
+	case QueryTypeLike:
+		return column + " LIKE ? ESCAPE '" + LikeEscapeChar + "'", []interface{}{"%" + EscapeLike(fmt.Sprintf("%v", filter.Value)) + "%"}, nil
+	case QueryTypePrefix:
+		return column + " LIKE ? ESCAPE '" + LikeEscapeChar + "'", []interface{}{EscapeLike(fmt.Sprintf("%v", filter.Value)) + "%"}, nil
+	case QueryTypeIn, QueryTypeNotIn:
+		values, ok := sliceValues(filter.Value)
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %s %s requires a slice", ErrQueryInvalidValue, filter.Field, filter.Operator)
+		}
+		if len(values) == 0 {
+			if filter.Operator == QueryTypeIn {
+				return "1 = 0", nil, nil
+			}
+			return "", nil, nil
+		}
+		if filter.Operator == QueryTypeIn {
+			return column + " IN (?)", []interface{}{filter.Value}, nil
+		}
+		return column + " NOT IN (?)", []interface{}{filter.Value}, nil
+	case QueryTypeIsNull:
+		if isNull, ok := filter.Value.(bool); ok && !isNull {
+			return column + " IS NOT NULL", nil, nil
+		}
+		return column + " IS NULL", nil, nil
+	}
+	return "", nil, fmt.Errorf("%w: %s", ErrQueryInvalidOperator, filter.Operator)
+}
+
+func sliceValues(value interface{}) (values []interface{}, ok bool) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+	for i := 0; i < v.Len(); i++ {
+		values = append(values, v.Index(i).Interface())
+	}
+	return values, true
+}
+
+// LikeEscapeChar LIKE的转义字符，反斜杠在MySQL与PostgreSQL字符串字面量中的含义不同，因此使用 !
+const LikeEscapeChar = "!"
+
+// EscapeLike 转义LIKE中的通配符 % _ 及转义字符本身，需要配合 ESCAPE '!' 使用
+func EscapeLike(value string) string {
+	return strings.NewReplacer(LikeEscapeChar, LikeEscapeChar+LikeEscapeChar, `%`, LikeEscapeChar+`%`, `_`, LikeEscapeChar+`_`).Replace(value)
+}
+
+// And 使用AND合并另一个查询条件，两边条件都会加上括号
+func (qp *QueryParam) And(other QueryParam) {
+	if len(strings.TrimSpace(other.WhereQuery)) == 0 {
+		return
+	}
+	if len(strings.TrimSpace(qp.WhereQuery)) == 0 {
+		qp.WhereQuery = other.WhereQuery
+	} else {
+		qp.WhereQuery = fmt.Sprintf("(%s) AND (%s)", strings.TrimSpace(qp.WhereQuery), strings.TrimSpace(other.WhereQuery))
+	}
+	qp.WhereArgs = append(qp.WhereArgs, other.WhereArgs...)
+}
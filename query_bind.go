@@ -0,0 +1,311 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/emicklei/go-restful/v3"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	MsgCodeInvalidQueryParameter = "invalidQueryParameter"
+	searchParameter              = "search"
+)
+
+// ListQueryReservedParameters 列表接口中不作为查询条件的参数
+var ListQueryReservedParameters = []string{"current", "pageSize", "order", "sorter", "cursor", "limit", LanguageParameter}
+
+// ListQueryOrderable 过滤结构体实现该接口时使用其返回的字段作为排序白名单，
+// 否则允许按id及过滤结构体声明的查询字段排序
+type ListQueryOrderable interface {
+	OrderColumns() QueryColumns
+}
+
+// ListQuery 列表接口的查询条件、分页及排序信息，Order为校验后的ORDER BY子句
+type ListQuery struct {
+	QueryParam
+	Pagination
+	Order  string
+	Orders QueryOrders
+}
+
+type queryBinding struct {
+	field     int
+	name      string
+	queryType string
+	paramType string
+	column    string
+	search    []string
+}
+
+// BindListQuery 根据过滤结构体字段的query标签生成查询条件，标签格式：
+//
+//	query:"name,like"                   参数名,查询类型,参数类型
+//	query:"enable,eq,bool"
+//	query:"ids,in,numberSlice,column=id" column指定数据库列名，默认为CamelString2Snake(参数名)
+//	query:"search:username;nickname"    使用search参数对多个字段进行OR查询，查询类型默认为like
+//
+// 参数类型未指定时根据字段类型推断，filter为指针时会将解析后的参数值写回结构体字段。
+// 分页参数按DefaultPaginationPolicy校验，未声明的参数或者参数值不合法时返回400的ErrorData
+func BindListQuery(req *restful.Request, filter interface{}) (query ListQuery, errData ErrorData) {
+	if query.Pagination, errData = GetRequestPagination(req, DefaultPaginationPolicy); errData.IsNotNil() {
+		return query, errData
+	}
+	value := reflect.ValueOf(filter)
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return query, Internal(fmt.Errorf("query filter must be a struct, got: %T", filter)).ErrorData(errData.Lang)
+	}
+	bindings, err := parseQueryBindings(value.Type())
+	if err != nil {
+		return query, Internal(err).ErrorData(errData.Lang)
+	}
+	columns := make(QueryColumns)
+	allowed := make(map[string]bool)
+	for _, name := range ListQueryReservedParameters {
+		allowed[name] = true
+	}
+	for _, binding := range bindings {
+		if len(binding.search) > 0 {
+			allowed[searchParameter] = true
+			for _, item := range binding.search {
+				columns.Allow(item, "")
+			}
+		} else {
+			allowed[binding.name] = true
+			columns.Allow(binding.name, binding.column)
+		}
+	}
+	orderColumns := QueryColumns{"id": "id"}
+	for k, v := range columns {
+		orderColumns[k] = v
+	}
+	if orderable, ok := filter.(ListQueryOrderable); ok {
+		orderColumns = orderable.OrderColumns()
+	}
+	invalid := make(FiledValidFailed)
+	if query.Orders, err = GetRequestOrder(req, orderColumns); err != nil {
+		invalid["order"] = err.Error()
+	}
+	query.Order = query.Orders.String()
+	for key := range req.Request.URL.Query() {
+		if !allowed[strings.TrimSuffix(key, "[]")] {
+			invalid[key] = "unknown parameter"
+		}
+	}
+	var filters []*QueryFilter
+	for _, binding := range bindings {
+		f, er := binding.bind(req, value)
+		if er != nil {
+			invalid[binding.name] = er.Error()
+			continue
+		}
+		if f != nil {
+			filters = append(filters, f)
+		}
+	}
+	if len(invalid) > 0 {
+		var names []string
+		for key := range invalid {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+		errData = ErrCodeInvalidQueryParameter.New(fmt.Errorf("invalid query parameter: %s", invalid.String()),
+			map[string]interface{}{"name": strings.Join(names, ",")}).ErrorData(errData.Lang)
+		errData.Fields = invalid
+		return query, errData
+	}
+	query.QueryParam, err = columns.Build(filters...)
+	if err != nil {
+		return query, ErrCodeInvalidQueryParameter.New(err, map[string]interface{}{"name": ""}).ErrorData(errData.Lang)
+	}
+	return query, errData
+}
+
+func parseQueryBindings(t reflect.Type) (bindings []queryBinding, err error) {
+	for i := 0; i < t.NumField(); i++ {
+		tag, exist := t.Field(i).Tag.Lookup("query")
+		if !exist || tag == "-" {
+			continue
+		}
+		items := strings.Split(tag, ",")
+		binding := queryBinding{field: i, name: strings.TrimSpace(items[0])}
+		if strings.HasPrefix(binding.name, searchParameter+":") {
+			binding.search = FilterEmptyStrings(strings.Split(strings.TrimPrefix(binding.name, searchParameter+":"), ";"))
+			binding.name = searchParameter
+			binding.queryType = QueryTypeLike
+			binding.paramType = ParamTypeString
+		}
+		var positional []string
+		for _, item := range items[1:] {
+			item = strings.TrimSpace(item)
+			if strings.HasPrefix(item, "column=") {
+				binding.column = strings.TrimPrefix(item, "column=")
+			} else {
+				positional = append(positional, item)
+			}
+		}
+		if len(positional) > 0 && len(positional[0]) > 0 {
+			binding.queryType = positional[0]
+		}
+		if len(positional) > 1 && len(positional[1]) > 0 {
+			binding.paramType = positional[1]
+		}
+		if len(binding.name) == 0 {
+			return nil, fmt.Errorf("query tag of field %s has no parameter name", t.Field(i).Name)
+		}
+		if len(binding.queryType) == 0 {
+			binding.queryType = QueryTypeEqual
+		}
+		if len(binding.paramType) == 0 {
+			binding.paramType = inferParamType(t.Field(i).Type)
+		}
+		bindings = append(bindings, binding)
+	}
+	return bindings, nil
+}
+
+func inferParamType(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return ParamTypeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ParamTypeNumber
+	case reflect.Slice, reflect.Array:
+		if inferParamType(t.Elem()) == ParamTypeNumber {
+			return ParamTypeNumberSlice
+		}
+		return ParamTypeStringSlice
+	}
+	return ParamTypeString
+}
+
+func (b queryBinding) bind(req *restful.Request, filter reflect.Value) (result *QueryFilter, err error) {
+	var raw []string
+	if b.paramType == ParamTypeStringSlice || b.paramType == ParamTypeNumberSlice {
+		for _, item := range append(req.QueryParameters(b.name+"[]"), req.QueryParameters(b.name)...) {
+			raw = append(raw, strings.Split(item, ",")...)
+		}
+		raw = FilterEmptyStrings(raw)
+		if len(raw) == 0 {
+			return nil, nil
+		}
+	} else {
+		v := strings.TrimSpace(req.QueryParameter(b.name))
+		if len(v) == 0 {
+			return nil, nil
+		}
+		raw = []string{v}
+	}
+	var value interface{}
+	switch b.paramType {
+	case ParamTypeString:
+		value = raw[0]
+	case ParamTypeNumber:
+		n, er := strconv.ParseInt(raw[0], 10, 64)
+		if er != nil {
+			return nil, errors.New("must be an integer")
+		}
+		value = n
+	case ParamTypeBool:
+		switch strings.ToLower(raw[0]) {
+		case "1", "t", "true":
+			value = Enable
+		case "0", "f", "false":
+			value = Disable
+		default:
+			return nil, errors.New("must be a boolean")
+		}
+	case ParamTypeStringSlice:
+		value = raw
+	case ParamTypeNumberSlice:
+		var numbers []int64
+		for _, item := range raw {
+			n, er := strconv.ParseInt(strings.TrimSpace(item), 10, 64)
+			if er != nil {
+				return nil, errors.New("must be a list of integers")
+			}
+			numbers = append(numbers, n)
+		}
+		value = numbers
+	default:
+		return nil, fmt.Errorf("unsupported parameter type: %s", b.paramType)
+	}
+	b.setField(filter, value)
+	if len(b.search) > 0 {
+		var items []*QueryFilter
+		for _, name := range b.search {
+			items = append(items, FilterCondition(name, b.queryType, value))
+		}
+		return FilterOr(items...), nil
+	}
+	switch b.queryType {
+	case QueryTypeEqual, QueryTypeNotEqual, QueryTypeGreater, QueryTypeGreaterEqual, QueryTypeLess, QueryTypeLessEqual,
+		QueryTypeLike, QueryTypePrefix, QueryTypeIn, QueryTypeNotIn:
+	default:
+		return nil, fmt.Errorf("unsupported query type: %s", b.queryType)
+	}
+	if (b.queryType == QueryTypeIn || b.queryType == QueryTypeNotIn) && reflect.TypeOf(value).Kind() != reflect.Slice {
+		value = []interface{}{value}
+	}
+	return FilterCondition(b.name, b.queryType, value), nil
+}
+
+// setField 将解析后的值写回过滤结构体，类型不兼容时忽略
+func (b queryBinding) setField(filter reflect.Value, value interface{}) {
+	if !filter.CanAddr() {
+		return
+	}
+	field := filter.Field(b.field)
+	if !field.CanSet() {
+		return
+	}
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		field = field.Elem()
+	}
+	v := reflect.ValueOf(value)
+	switch {
+	case field.Kind() == reflect.Bool && v.Kind() == reflect.Int:
+		field.SetBool(v.Int() == Enable)
+	case (field.Kind() == reflect.Slice) && v.Kind() == reflect.Slice:
+		slice := reflect.MakeSlice(field.Type(), 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item := v.Index(i)
+			if !item.Type().ConvertibleTo(field.Type().Elem()) {
+				return
+			}
+			slice = reflect.Append(slice, item.Convert(field.Type().Elem()))
+		}
+		field.Set(slice)
+	case v.Type().ConvertibleTo(field.Type()) && (v.Kind() == reflect.String) == (field.Kind() == reflect.String):
+		field.Set(v.Convert(field.Type()))
+	}
+}
@@ -0,0 +1,47 @@
+package common
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+type listQueryTestFilter struct {
+	Username string  `query:"username,like"`
+	Enable   *bool   `query:"enable,eq,bool"`
+	IDs      []int64 `query:"ids,in,column=id"`
+	Search   string  `query:"search:username;nickname"`
+}
+
+func TestBindListQuery(t *testing.T) {
+	req := restful.NewRequest(httptest.NewRequest("GET", "/users?username=a&enable=true&ids=1,2&current=2&pageSize=10&order=-id&lang=en", nil))
+	var filter listQueryTestFilter
+	query, errData := BindListQuery(req, &filter)
+	if errData.IsNotNil() {
+		t.Fatalf("unexpected error: %v", errData.Err)
+	}
+	if query.WhereQuery != "(username LIKE ? ESCAPE '!' AND enable = ? AND id IN (?))" {
+		t.Fatalf("where: %s", query.WhereQuery)
+	}
+	if !reflect.DeepEqual(query.WhereArgs, []interface{}{"%a%", Enable, []int64{1, 2}}) {
+		t.Fatalf("args: %v", query.WhereArgs)
+	}
+	if query.Order != "id DESC" || query.Offset != 10 || query.Limit != 10 {
+		t.Fatalf("order: %s, offset: %d, limit: %d", query.Order, query.Offset, query.Limit)
+	}
+	if filter.Username != "a" || filter.Enable == nil || !*filter.Enable || !reflect.DeepEqual(filter.IDs, []int64{1, 2}) {
+		t.Fatalf("filter: %+v", filter)
+	}
+
+	req = restful.NewRequest(httptest.NewRequest("GET", "/users?unknown=1&ids=a", nil))
+	_, errData = BindListQuery(req, &filter)
+	if !errors.Is(errData.Err, ErrCodeInvalidQueryParameter) || errData.ResponseCode != 400 {
+		t.Fatalf("expected invalid query parameter, got: %v", errData.Err)
+	}
+	if len(errData.Fields) != 2 || len(errData.Fields["unknown"]) == 0 || len(errData.Fields["ids"]) == 0 {
+		t.Fatalf("fields: %v", errData.Fields)
+	}
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/emicklei/go-restful/v3"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	ErrCursorInvalid     = errors.New("cursor is invalid")
+	ErrCursorSecretEmpty = errors.New("cursor secret is empty")
+)
+
+// ResponseCursorList 游标分页的响应数据
+type ResponseCursorList struct {
+	Data       any    `json:"data" yaml:"data"`
+	NextCursor string `json:"nextCursor,omitempty" yaml:"nextCursor"`
+	PrevCursor string `json:"prevCursor,omitempty" yaml:"prevCursor"`
+	HasMore    bool   `json:"hasMore" yaml:"hasMore"`
+}
+
+// CursorCodec 使用HMAC-SHA256对游标签名，防止客户端伪造查询条件
+type CursorCodec struct {
+	secret []byte
+}
+
+// NewCursorCodec secret不能为空，建议使用32字节以上的随机数据
+func NewCursorCodec(secret []byte) (*CursorCodec, error) {
+	if len(secret) == 0 {
+		return nil, ErrCursorSecretEmpty
+	}
+	return &CursorCodec{secret: append([]byte(nil), secret...)}, nil
+}
+
+type cursorPayload struct {
+	Orders   string        `json:"o"`
+	Values   []interface{} `json:"v"`
+	Times    []int         `json:"t,omitempty"` // Values中为时间的下标
+	Backward bool          `json:"b,omitempty"`
+}
+
+// Encode 生成游标，values与orders一一对应
+func (c *CursorCodec) Encode(orders QueryOrders, values []interface{}, backward bool) (cursor string, err error) {
+	if c == nil || len(c.secret) == 0 {
+		return "", ErrCursorSecretEmpty
+	}
+	if len(orders) != len(values) {
+		return "", fmt.Errorf("cursor values length %d not equal to orders length %d", len(values), len(orders))
+	}
+	payload := cursorPayload{Orders: orders.String(), Backward: backward}
+	for i, value := range values {
+		if t, ok := value.(time.Time); ok {
+			payload.Times = append(payload.Times, i)
+			value = t.Format(time.RFC3339Nano)
+		}
+		payload.Values = append(payload.Values, value)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(c.sign(data)), nil
+}
+
+// Decode 校验并解析游标，游标的排序字段需要与orders一致
+func (c *CursorCodec) Decode(cursor string, orders QueryOrders) (values []interface{}, backward bool, err error) {
+	if c == nil || len(c.secret) == 0 {
+		return nil, false, ErrCursorSecretEmpty
+	}
+	items := strings.Split(cursor, ".")
+	if len(items) != 2 {
+		return nil, false, ErrCursorInvalid
+	}
+	data, err := base64.RawURLEncoding.DecodeString(items[0])
+	if err != nil {
+		return nil, false, ErrCursorInvalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(items[1])
+	if err != nil || !hmac.Equal(signature, c.sign(data)) {
+		return nil, false, ErrCursorInvalid
+	}
+	var payload cursorPayload
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&payload); err != nil {
+		return nil, false, ErrCursorInvalid
+	}
+	if payload.Orders != orders.String() || len(payload.Values) != len(orders) {
+		return nil, false, fmt.Errorf("%w: order changed", ErrCursorInvalid)
+	}
+	for i, value := range payload.Values {
+		if number, ok := value.(json.Number); ok {
+			if n, er := number.Int64(); er == nil {
+				payload.Values[i] = n
+			} else if f, er := number.Float64(); er == nil {
+				payload.Values[i] = f
+			}
+		}
+	}
+	for _, i := range payload.Times {
+		if i < 0 || i >= len(payload.Values) {
+			return nil, false, ErrCursorInvalid
+		}
+		if t, er := time.Parse(time.RFC3339Nano, fmt.Sprintf("%v", payload.Values[i])); er == nil {
+			payload.Values[i] = t
+		} else {
+			return nil, false, ErrCursorInvalid
+		}
+	}
+	return payload.Values, payload.Backward, nil
+}
+
+func (c *CursorCodec) sign(data []byte) []byte {
+	h := hmac.New(sha256.New, c.secret)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// CursorPage 游标分页信息，查询时使用QueryParam作为条件、Orders作为排序，并多查询一条记录用于判断是否还有数据：
+//
+//	db.Where(page.WhereQuery, page.WhereArgs...).Order(page.Orders.String()).Limit(page.Limit + 1).Find(&rows)
+type CursorPage struct {
+	QueryParam
+	Cursor   string
+	Limit    int
+	Backward bool
+	Orders   QueryOrders // 实际查询使用的排序，向前翻页时排序方向取反
+	orders   QueryOrders
+}
+
+// GetRequestCursorPagination 解析请求中的cursor和limit参数，limit按DefaultPaginationPolicy校验。
+// orders中没有id时会追加id作为唯一排序字段，排序字段的值不能为NULL，游标不合法时返回400的ErrorData
+func GetRequestCursorPagination(req *restful.Request, codec *CursorCodec, orders QueryOrders) (page CursorPage, errData ErrorData) {
+	errData.Lang = GetLanguageFromReq(req, RequestLanguageKey)
+	policy := DefaultPaginationPolicy
+	limit, err := policy.Apply(DefaultPage, String2Int(req.QueryParameter("limit"), policy.DefaultPageSize))
+	if err != nil {
+		return page, ErrCodeInvalidPagination.New(err,
+			map[string]interface{}{"maxPageSize": policy.MaxPageSize, "maxOffset": policy.MaxOffset}).ErrorData(errData.Lang)
+	}
+	page.Limit = limit.Limit
+	page.Cursor = strings.TrimSpace(req.QueryParameter("cursor"))
+	page.orders = withUniqueOrder(orders)
+	page.Orders = page.orders
+	if len(page.Cursor) == 0 {
+		return page, errData
+	}
+	values, backward, err := codec.Decode(page.Cursor, page.orders)
+	if errors.Is(err, ErrCursorSecretEmpty) {
+		return page, Internal(err).ErrorData(errData.Lang)
+	}
+	if err != nil {
+		errData = ErrCodeInvalidQueryParameter.New(err, map[string]interface{}{"name": "cursor"}).ErrorData(errData.Lang)
+		errData.Fields = FiledValidFailed{"cursor": err.Error()}
+		return page, errData
+	}
+	page.Backward = backward
+	if backward {
+		page.Orders = nil
+		for _, item := range page.orders {
+			page.Orders = append(page.Orders, QueryOrder{Column: item.Column, Desc: !item.Desc})
+		}
+	}
+	if page.QueryParam, err = keysetCondition(page.Orders, values); err != nil {
+		return page, ErrCodeInvalidQueryParameter.New(err, map[string]interface{}{"name": "cursor"}).ErrorData(errData.Lang)
+	}
+	return page, errData
+}
+
+func withUniqueOrder(orders QueryOrders) (results QueryOrders) {
+	desc := true
+	for _, item := range orders {
+		if item.Column == "id" {
+			return orders
+		}
+		desc = item.Desc
+	}
+	results = append(results, orders...)
+	return append(results, QueryOrder{Column: "id", Desc: desc})
+}
+
+// keysetCondition (a > ?) OR (a = ? AND b > ?) ...
+func keysetCondition(orders QueryOrders, values []interface{}) (QueryParam, error) {
+	columns := make(QueryColumns)
+	var conditions []*QueryFilter
+	for i, item := range orders {
+		columns[item.Column] = item.Column
+		var group []*QueryFilter
+		for j := 0; j < i; j++ {
+			group = append(group, FilterEq(orders[j].Column, values[j]))
+		}
+		if item.Desc {
+			group = append(group, FilterLt(item.Column, values[i]))
+		} else {
+			group = append(group, FilterGt(item.Column, values[i]))
+		}
+		conditions = append(conditions, FilterAnd(group...))
+	}
+	return columns.Build(FilterOr(conditions...))
+}
+
+// NewResponseCursorList 根据查询结果生成游标分页响应，rows为按page.Orders查询的最多page.Limit+1条记录
+func NewResponseCursorList(codec *CursorCodec, page CursorPage, rows interface{}) (list ResponseCursorList, err error) {
+	value := reflect.ValueOf(rows)
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Slice {
+		return list, fmt.Errorf("cursor rows must be a slice, got: %T", rows)
+	}
+	list.HasMore = value.Len() > page.Limit
+	if list.HasMore {
+		value = value.Slice(0, page.Limit)
+	}
+	if page.Backward {
+		reversed := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			reversed.Index(value.Len() - 1 - i).Set(value.Index(i))
+		}
+		value = reversed
+	}
+	list.Data = value.Interface()
+	if value.Len() == 0 {
+		return list, nil
+	}
+	if (!page.Backward && list.HasMore) || (page.Backward && len(page.Cursor) > 0) {
+		if list.NextCursor, err = rowCursor(codec, page.orders, value.Index(value.Len()-1), false); err != nil {
+			return list, err
+		}
+	}
+	if (page.Backward && list.HasMore) || (!page.Backward && len(page.Cursor) > 0) {
+		if list.PrevCursor, err = rowCursor(codec, page.orders, value.Index(0), true); err != nil {
+			return list, err
+		}
+	}
+	return list, nil
+}
+
+func rowCursor(codec *CursorCodec, orders QueryOrders, row reflect.Value, backward bool) (string, error) {
+	for row.Kind() == reflect.Ptr || row.Kind() == reflect.Interface {
+		row = row.Elem()
+	}
+	if row.Kind() != reflect.Struct {
+		return "", fmt.Errorf("cursor row must be a struct, got: %s", row.Kind())
+	}
+	indexes := make(map[string][]int)
+	walkQueryFields(row.Type(), nil, func(name, column string, index []int) {
+		indexes[column] = index
+	})
+	var values []interface{}
+	for _, item := range orders {
+		index, exist := indexes[item.Column]
+		if !exist {
+			return "", fmt.Errorf("cursor column %s not found in %s", item.Column, row.Type().Name())
+		}
+		field, err := row.FieldByIndexErr(index)
+		if err != nil {
+			return "", err
+		}
+		if field.Kind() == reflect.Ptr && !field.IsNil() {
+			field = field.Elem()
+		}
+		values = append(values, field.Interface())
+	}
+	return codec.Encode(orders, values, backward)
+}
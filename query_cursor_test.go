@@ -0,0 +1,63 @@
+package common
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+type cursorTestModel struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func TestCursorPagination(t *testing.T) {
+	if _, err := NewCursorCodec(nil); !errors.Is(err, ErrCursorSecretEmpty) {
+		t.Fatalf("expected empty secret error, got: %v", err)
+	}
+	codec, err := NewCursorCodec([]byte("cursor-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders := QueryOrders{{Column: "created_at", Desc: true}}
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := []cursorTestModel{{ID: 3, CreatedAt: now}, {ID: 2, CreatedAt: now}, {ID: 1, CreatedAt: now}}
+
+	page, errData := GetRequestCursorPagination(restful.NewRequest(httptest.NewRequest("GET", "/?limit=2", nil)), codec, orders)
+	if errData.IsNotNil() {
+		t.Fatal(errData.Err)
+	}
+	list, err := NewResponseCursorList(codec, page, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !list.HasMore || len(list.NextCursor) == 0 || len(list.PrevCursor) != 0 {
+		t.Fatalf("list: %+v", list)
+	}
+
+	page, errData = GetRequestCursorPagination(restful.NewRequest(httptest.NewRequest("GET", "/?limit=2&cursor="+url.QueryEscape(list.NextCursor), nil)), codec, orders)
+	if errData.IsNotNil() {
+		t.Fatal(errData.Err)
+	}
+	if page.WhereQuery != "(created_at < ? OR (created_at = ? AND id < ?))" || len(page.WhereArgs) != 3 || page.WhereArgs[2] != int64(2) {
+		t.Fatalf("where: %s, args: %v", page.WhereQuery, page.WhereArgs)
+	}
+
+	other, _ := NewCursorCodec([]byte("other-secret"))
+	forged, _ := other.Encode(withUniqueOrder(orders), []interface{}{now, 100}, false)
+	_, errData = GetRequestCursorPagination(restful.NewRequest(httptest.NewRequest("GET", "/?cursor="+url.QueryEscape(forged), nil)), codec, orders)
+	if !errors.Is(errData.Err, ErrCodeInvalidQueryParameter) || !errors.Is(errData.Err, ErrCursorInvalid) || errData.ResponseCode != 400 {
+		t.Fatalf("expected invalid cursor, got: %v", errData.Err)
+	}
+	_, errData = GetRequestCursorPagination(restful.NewRequest(httptest.NewRequest("GET", "/?cursor="+url.QueryEscape(list.NextCursor), nil)), codec, QueryOrders{{Column: "id"}})
+	if !errors.Is(errData.Err, ErrCursorInvalid) {
+		t.Fatalf("expected order changed, got: %v", errData.Err)
+	}
+	if _, _, err = (&CursorCodec{}).Decode(list.NextCursor, orders); !errors.Is(err, ErrCursorSecretEmpty) {
+		t.Fatalf("expected empty secret error, got: %v", err)
+	}
+}
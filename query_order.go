@@ -0,0 +1,140 @@
+/*
+Copyright 2022 The efucloud.com Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/emicklei/go-restful/v3"
+	"strings"
+)
+
+// QueryOrder 排序字段，Column为白名单中的数据库列名
+type QueryOrder struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc"`
+}
+
+type QueryOrders []QueryOrder
+
+// String 渲染为ORDER BY子句，如: created_at DESC, name ASC
+func (orders QueryOrders) String() string {
+	var items []string
+	for _, item := range orders {
+		if item.Desc {
+			items = append(items, item.Column+" DESC")
+		} else {
+			items = append(items, item.Column+" ASC")
+		}
+	}
+	return strings.Join(items, ", ")
+}
+
+func (orders QueryOrders) add(columns QueryColumns, name string, desc bool) (QueryOrders, error) {
+	column, ok := columns.Column(name)
+	if !ok {
+		column, ok = columns.Column(CamelString2Snake(name))
+	}
+	if !ok {
+		return orders, fmt.Errorf("%w: order by %s", ErrQueryFieldNotAllowed, name)
+	}
+	for _, item := range orders {
+		if item.Column == column {
+			return orders, nil
+		}
+	}
+	return append(orders, QueryOrder{Column: column, Desc: desc}), nil
+}
+
+// ParseQueryOrder 解析排序参数，多个字段使用逗号分隔，支持 -createdAt,name 以及 createdAt desc,name asc 两种格式
+func ParseQueryOrder(order string, columns QueryColumns) (orders QueryOrders, err error) {
+	for _, item := range strings.Split(order, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		desc := false
+		if strings.HasPrefix(item, "-") {
+			desc = true
+			item = strings.TrimPrefix(item, "-")
+		} else if strings.HasPrefix(item, "+") {
+			item = strings.TrimPrefix(item, "+")
+		} else if fields := strings.Fields(item); len(fields) == 2 {
+			switch strings.ToLower(fields[1]) {
+			case "desc", "descend":
+				desc = true
+			case "asc", "ascend":
+			default:
+				return nil, fmt.Errorf("%w: order direction %s", ErrQueryInvalidOperator, fields[1])
+			}
+			item = fields[0]
+		}
+		if orders, err = orders.add(columns, strings.TrimSpace(item), desc); err != nil {
+			return nil, err
+		}
+	}
+	return orders, nil
+}
+
+// ParseQuerySorter 解析antd ProTable的sorter参数，如: {"createdAt":"descend","name":"ascend"}，保持字段顺序
+func ParseQuerySorter(sorter string, columns QueryColumns) (orders QueryOrders, err error) {
+	decoder := json.NewDecoder(strings.NewReader(sorter))
+	if token, er := decoder.Token(); er != nil || token != json.Delim('{') {
+		return nil, fmt.Errorf("%w: sorter must be a json object", ErrQueryInvalidValue)
+	}
+	for decoder.More() {
+		var name, direction string
+		token, er := decoder.Token()
+		if er != nil {
+			return nil, fmt.Errorf("%w: sorter decode failed, err: %s", ErrQueryInvalidValue, er.Error())
+		}
+		name, _ = token.(string)
+		if er = decoder.Decode(&direction); er != nil {
+			return nil, fmt.Errorf("%w: sorter decode failed, err: %s", ErrQueryInvalidValue, er.Error())
+		}
+		var desc bool
+		switch strings.ToLower(direction) {
+		case "descend", "desc":
+			desc = true
+		case "ascend", "asc":
+		case "":
+			continue
+		default:
+			return nil, fmt.Errorf("%w: order direction %s", ErrQueryInvalidOperator, direction)
+		}
+		if orders, err = orders.add(columns, name, desc); err != nil {
+			return nil, err
+		}
+	}
+	return orders, nil
+}
+
+// GetRequestOrder 从请求的sorter或order参数中解析排序字段，均为空时使用DefaultOrder
+func GetRequestOrder(req *restful.Request, columns QueryColumns) (orders QueryOrders, err error) {
+	if sorter := strings.TrimSpace(req.QueryParameter("sorter")); len(sorter) > 0 {
+		if orders, err = ParseQuerySorter(sorter, columns); err != nil || len(orders) > 0 {
+			return orders, err
+		}
+	}
+	if order := strings.TrimSpace(req.QueryParameter("order")); len(order) > 0 {
+		return ParseQueryOrder(order, columns)
+	}
+	if _, ok := columns.Column("id"); ok {
+		return ParseQueryOrder(DefaultOrder, columns)
+	}
+	return nil, nil
+}
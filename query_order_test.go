@@ -0,0 +1,85 @@
+package common
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+var orderTestColumns = QueryColumns{"id": "id", "name": "name", "createdAt": "created_at"}
+
+func TestParseQueryOrder(t *testing.T) {
+	cases := []struct {
+		order    string
+		expected string
+	}{
+		{order: "-createdAt,+name", expected: "created_at DESC, name ASC"},
+		{order: "name", expected: "name ASC"},
+		{order: "created_at desc, name ASC", expected: "created_at DESC, name ASC"},
+		{order: "name descend,-name", expected: "name DESC"},
+		{order: " , ", expected: ""},
+	}
+	for _, c := range cases {
+		orders, err := ParseQueryOrder(c.order, orderTestColumns)
+		if err != nil {
+			t.Fatalf("%s: unexpected err: %v", c.order, err)
+		}
+		if orders.String() != c.expected {
+			t.Fatalf("%s: got %q, expected %q", c.order, orders.String(), c.expected)
+		}
+	}
+	for _, order := range []string{"password", "name;drop", "name desc; drop table users", "-name--", "(select 1)", "name sideways"} {
+		if orders, err := ParseQueryOrder(order, orderTestColumns); err == nil {
+			t.Fatalf("%s: expected err, got %q", order, orders.String())
+		}
+	}
+	if _, err := ParseQueryOrder("name;drop", orderTestColumns); !errors.Is(err, ErrQueryFieldNotAllowed) {
+		t.Fatalf("expected field not allowed, got %v", err)
+	}
+	if _, err := ParseQueryOrder("name up", orderTestColumns); !errors.Is(err, ErrQueryInvalidOperator) {
+		t.Fatalf("expected invalid operator, got %v", err)
+	}
+}
+
+func TestParseQuerySorter(t *testing.T) {
+	orders, err := ParseQuerySorter(`{"name":"ascend","createdAt":"descend","id":""}`, orderTestColumns)
+	if err != nil || orders.String() != "name ASC, created_at DESC" {
+		t.Fatalf("orders: %q, err: %v", orders.String(), err)
+	}
+	if orders, err = ParseQuerySorter(`{"createdAt":"desc","name":"asc"}`, orderTestColumns); err != nil || orders.String() != "created_at DESC, name ASC" {
+		t.Fatalf("orders: %q, err: %v", orders.String(), err)
+	}
+	for _, sorter := range []string{`["name"]`, `{"name":1}`, `{"name;drop":"ascend"}`, `{"name":"ascend; drop"}`, `{`} {
+		if orders, err = ParseQuerySorter(sorter, orderTestColumns); err == nil {
+			t.Fatalf("%s: expected err, got %q", sorter, orders.String())
+		}
+	}
+}
+
+func TestGetRequestOrder(t *testing.T) {
+	cases := []struct {
+		query    url.Values
+		columns  QueryColumns
+		expected string
+	}{
+		{query: url.Values{}, columns: orderTestColumns, expected: "id DESC"},
+		{query: url.Values{}, columns: QueryColumns{"name": "name"}, expected: ""},
+		{query: url.Values{"order": {"-name"}}, columns: orderTestColumns, expected: "name DESC"},
+		{query: url.Values{"sorter": {`{"createdAt":"ascend"}`}, "order": {"-name"}}, columns: orderTestColumns, expected: "created_at ASC"},
+		{query: url.Values{"sorter": {`{}`}, "order": {"-name"}}, columns: orderTestColumns, expected: "name DESC"},
+	}
+	for _, c := range cases {
+		req := restful.NewRequest(httptest.NewRequest("GET", "/users?"+c.query.Encode(), nil))
+		orders, err := GetRequestOrder(req, c.columns)
+		if err != nil || orders.String() != c.expected {
+			t.Fatalf("%s: got %q, err: %v, expected %q", c.query.Encode(), orders.String(), err, c.expected)
+		}
+	}
+	req := restful.NewRequest(httptest.NewRequest("GET", "/users?order="+url.QueryEscape("name;drop"), nil))
+	if _, err := GetRequestOrder(req, orderTestColumns); !errors.Is(err, ErrQueryFieldNotAllowed) {
+		t.Fatalf("expected field not allowed, got %v", err)
+	}
+}
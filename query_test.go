@@ -0,0 +1,77 @@
+package common
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type queryTestModel struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Username  string    `gorm:"column:user_name" json:"username"`
+	Nickname  string    `json:"nickname"`
+	Enable    uint      `json:"enable"`
+	Secret    string    `json:"-"`
+	Owner     struct{}  `gorm:"-" json:"owner"`
+}
+
+func TestQueryColumns(t *testing.T) {
+	columns := NewQueryColumns(&queryTestModel{})
+	expected := QueryColumns{"id": "id", "createdAt": "created_at", "username": "user_name", "nickname": "nickname", "enable": "enable"}
+	if !reflect.DeepEqual(columns, expected) {
+		t.Fatalf("columns: %v, expected: %v", columns, expected)
+	}
+}
+
+func TestQueryBuild(t *testing.T) {
+	columns := NewQueryColumns(queryTestModel{})
+	cases := []struct {
+		filters []*QueryFilter
+		query   string
+		args    []interface{}
+	}{
+		{
+			filters: []*QueryFilter{FilterEq("enable", 1), FilterOr(FilterLike("username", "a%b"), FilterPrefix("nickname", "c_"))},
+			query:   "(enable = ? AND (user_name LIKE ? ESCAPE '!' OR nickname LIKE ? ESCAPE '!'))",
+			args:    []interface{}{1, `%a!%b%`, `c!_%`},
+		},
+		{
+			filters: []*QueryFilter{FilterNot(FilterIn("id", []uint{1, 2})), FilterBetween("createdAt", 1, 2), FilterIsNull("nickname")},
+			query:   "(NOT (id IN (?)) AND created_at BETWEEN ? AND ? AND nickname IS NULL)",
+			args:    []interface{}{[]uint{1, 2}, 1, 2},
+		},
+		{
+			filters: []*QueryFilter{FilterIn("id", []uint{}), FilterNotIn("id", []uint{}), FilterAnd()},
+			query:   "1 = 0",
+		},
+		{
+			filters: []*QueryFilter{FilterLike("username", `a!\b`), FilterNot(FilterNotIn("id", []uint{}))},
+			query:   "(user_name LIKE ? ESCAPE '!' AND 1 = 0)",
+			args:    []interface{}{`%a!!\b%`},
+		},
+		{
+			filters: nil,
+			query:   "",
+		},
+	}
+	for _, c := range cases {
+		qp, err := columns.Build(c.filters...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if qp.WhereQuery != c.query || !reflect.DeepEqual(qp.WhereArgs, c.args) {
+			t.Fatalf("query: %q args: %v, expected query: %q args: %v", qp.WhereQuery, qp.WhereArgs, c.query, c.args)
+		}
+	}
+	if _, err := columns.Build(FilterEq("secret", "x")); !errors.Is(err, ErrQueryFieldNotAllowed) {
+		t.Fatalf("expected field not allowed, got: %v", err)
+	}
+	if _, err := columns.Build(&QueryFilter{Logic: QueryLogicNot}); !errors.Is(err, ErrQueryInvalidValue) {
+		t.Fatalf("expected invalid value for empty not, got: %v", err)
+	}
+	if _, err := columns.Build(FilterEq("id; DROP TABLE account", 1)); !errors.Is(err, ErrQueryFieldNotAllowed) {
+		t.Fatalf("expected field not allowed, got: %v", err)
+	}
+}
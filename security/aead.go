@@ -0,0 +1,354 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/chacha20poly1305"
+	"io"
+	"sort"
+	"sync"
+)
+
+const (
+	AlgorithmAES256GCM        = "A256GCM"
+	AlgorithmChaCha20Poly1305 = "C20P"
+
+	// EnvelopeVersion 当前的密文格式版本
+	EnvelopeVersion byte = 1
+	// SymmetricKeySize AES-256-GCM及ChaCha20-Poly1305的密钥长度
+	SymmetricKeySize = 32
+)
+
+var (
+	ErrEnvelopeInvalid     = errors.New("encrypted envelope is invalid")
+	ErrSymmetricKeyMissing = errors.New("symmetric key not found")
+	ErrDecryptFailed       = errors.New("decrypt failed")
+)
+
+var (
+	algorithmIDs = map[string]byte{AlgorithmAES256GCM: 1, AlgorithmChaCha20Poly1305: 2}
+	nonceSizes   = map[string]int{AlgorithmAES256GCM: 12, AlgorithmChaCha20Poly1305: chacha20poly1305.NonceSize}
+)
+
+// Envelope 自描述的密文：版本|算法|密钥ID长度|密钥ID|随机数|密文及认证标签，头部作为关联数据参与认证
+type Envelope struct {
+	Version    byte
+	Algorithm  string
+	KeyID      string
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+func (e Envelope) Marshal() ([]byte, error) {
+	header, err := e.header()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, len(header)+len(e.Nonce)+len(e.Ciphertext))
+	data = append(data, header...)
+	data = append(data, e.Nonce...)
+	return append(data, e.Ciphertext...), nil
+}
+
+// header 版本|算法|密钥ID长度|密钥ID
+func (e Envelope) header() ([]byte, error) {
+	algorithm, exist := algorithmIDs[e.Algorithm]
+	if !exist {
+		return nil, fmt.Errorf("unsupported encrypt algorithm: %s", e.Algorithm)
+	}
+	if len(e.KeyID) > 255 {
+		return nil, errors.New("key id is too long")
+	}
+	data := make([]byte, 0, 3+len(e.KeyID))
+	data = append(data, e.Version, algorithm, byte(len(e.KeyID)))
+	return append(data, e.KeyID...), nil
+}
+
+// additionalData 头部与调用方的associatedData一起参与认证，防止版本、算法、密钥ID被篡改
+func (e Envelope) additionalData(associatedData []byte) ([]byte, error) {
+	header, err := e.header()
+	if err != nil {
+		return nil, err
+	}
+	return append(header, associatedData...), nil
+}
+
+// ParseEnvelope 解析Envelope.Marshal生成的密文
+func ParseEnvelope(data []byte) (envelope Envelope, err error) {
+	if len(data) < 3 || data[0] != EnvelopeVersion {
+		return envelope, ErrEnvelopeInvalid
+	}
+	envelope.Version = data[0]
+	for name, id := range algorithmIDs {
+		if id == data[1] {
+			envelope.Algorithm = name
+		}
+	}
+	nonceSize := nonceSizes[envelope.Algorithm]
+	keyIDLength := int(data[2])
+	if nonceSize == 0 || len(data) < 3+keyIDLength+nonceSize {
+		return envelope, ErrEnvelopeInvalid
+	}
+	data = data[3:]
+	envelope.KeyID = string(data[:keyIDLength])
+	envelope.Nonce = data[keyIDLength : keyIDLength+nonceSize]
+	envelope.Ciphertext = data[keyIDLength+nonceSize:]
+	return envelope, nil
+}
+
+// SymmetricKey 对称密钥
+type SymmetricKey struct {
+	ID        string
+	Algorithm string
+	Secret    []byte
+}
+
+// GenerateSymmetricKey 生成随机的对称密钥，algorithm为空时使用AES-256-GCM
+func GenerateSymmetricKey(id, algorithm string) (key SymmetricKey, err error) {
+	if len(algorithm) == 0 {
+		algorithm = AlgorithmAES256GCM
+	}
+	key = SymmetricKey{ID: id, Algorithm: algorithm, Secret: make([]byte, SymmetricKeySize)}
+	if _, err = io.ReadFull(rand.Reader, key.Secret); err != nil {
+		return key, err
+	}
+	return key, nil
+}
+
+func (k SymmetricKey) aead() (cipher.AEAD, error) {
+	if len(k.Secret) != SymmetricKeySize {
+		return nil, fmt.Errorf("key %s must be %d bytes", k.ID, SymmetricKeySize)
+	}
+	switch k.Algorithm {
+	case AlgorithmAES256GCM:
+		block, err := aes.NewCipher(k.Secret)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case AlgorithmChaCha20Poly1305:
+		return chacha20poly1305.New(k.Secret)
+	}
+	return nil, fmt.Errorf("unsupported encrypt algorithm: %s", k.Algorithm)
+}
+
+// Encrypt 使用随机数加密，associatedData参与认证但不加密，解密时需要提供相同的值
+func (k SymmetricKey) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	aead, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	envelope := Envelope{Version: EnvelopeVersion, Algorithm: k.Algorithm, KeyID: k.ID, Nonce: make([]byte, aead.NonceSize())}
+	if _, err = io.ReadFull(rand.Reader, envelope.Nonce); err != nil {
+		return nil, err
+	}
+	additionalData, err := envelope.additionalData(associatedData)
+	if err != nil {
+		return nil, err
+	}
+	envelope.Ciphertext = aead.Seal(nil, envelope.Nonce, plaintext, additionalData)
+	return envelope.Marshal()
+}
+
+func (k SymmetricKey) open(envelope Envelope, associatedData []byte) ([]byte, error) {
+	if envelope.Algorithm != k.Algorithm {
+		return nil, ErrEnvelopeInvalid
+	}
+	aead, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	additionalData, err := envelope.additionalData(associatedData)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, envelope.Nonce, envelope.Ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return plaintext, nil
+}
+
+// SymmetricKeyConfig 配置中的密钥，Secret为base64编码的32字节密钥
+type SymmetricKeyConfig struct {
+	ID        string `json:"id" yaml:"id" description:"密钥ID，写入密文用于轮换"`
+	Algorithm string `json:"algorithm" yaml:"algorithm" description:"A256GCM或者C20P，默认A256GCM"`
+	Secret    string `json:"secret" yaml:"secret" description:"base64编码的密钥"`
+}
+
+// KeyringConfig 密钥环配置，Active为加密使用的密钥ID，其它密钥只用于解密
+type KeyringConfig struct {
+	Active string               `json:"active" yaml:"active" description:"加密使用的密钥ID"`
+	Keys   []SymmetricKeyConfig `json:"keys" yaml:"keys" description:"所有密钥"`
+}
+
+// Keyring 密钥环，使用当前密钥加密，根据密文中的密钥ID选择解密的密钥
+type Keyring struct {
+	mutex  sync.RWMutex
+	active string
+	keys   map[string]SymmetricKey
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string]SymmetricKey)}
+}
+
+// NewKeyringFromConfig 从配置加载密钥环，Active为空时使用第一个密钥
+func NewKeyringFromConfig(config KeyringConfig) (*Keyring, error) {
+	keyring := NewKeyring()
+	for _, item := range config.Keys {
+		secret, err := base64.StdEncoding.DecodeString(item.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("decode key %s failed, err: %s", item.ID, err.Error())
+		}
+		algorithm := item.Algorithm
+		if len(algorithm) == 0 {
+			algorithm = AlgorithmAES256GCM
+		}
+		if err = keyring.Add(SymmetricKey{ID: item.ID, Algorithm: algorithm, Secret: secret}); err != nil {
+			return nil, err
+		}
+	}
+	active := config.Active
+	if len(active) == 0 && len(config.Keys) > 0 {
+		active = config.Keys[0].ID
+	}
+	if err := keyring.SetActive(active); err != nil {
+		return nil, err
+	}
+	return keyring, nil
+}
+
+// Add 添加密钥，ID不能重复
+func (r *Keyring) Add(key SymmetricKey) error {
+	if len(key.ID) == 0 {
+		return errors.New("key id can not be empty")
+	}
+	if _, err := key.aead(); err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exist := r.keys[key.ID]; exist {
+		return fmt.Errorf("key %s already exists", key.ID)
+	}
+	r.keys[key.ID] = key
+	return nil
+}
+
+// SetActive 设置加密使用的密钥，用于轮换
+func (r *Keyring) SetActive(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exist := r.keys[id]; !exist {
+		return fmt.Errorf("%w: %s", ErrSymmetricKeyMissing, id)
+	}
+	r.active = id
+	return nil
+}
+
+// Remove 删除不再使用的密钥，不能删除当前密钥
+func (r *Keyring) Remove(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if id == r.active {
+		return errors.New("can not remove active key")
+	}
+	delete(r.keys, id)
+	return nil
+}
+
+// Active 当前加密使用的密钥ID
+func (r *Keyring) Active() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.active
+}
+
+// KeyIDs 所有密钥ID
+func (r *Keyring) KeyIDs() (ids []string) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (r *Keyring) key(id string) (SymmetricKey, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	key, exist := r.keys[id]
+	if !exist {
+		return key, fmt.Errorf("%w: %s", ErrSymmetricKeyMissing, id)
+	}
+	return key, nil
+}
+
+// Encrypt 使用当前密钥加密
+func (r *Keyring) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	key, err := r.key(r.Active())
+	if err != nil {
+		return nil, err
+	}
+	return key.Encrypt(plaintext, associatedData)
+}
+
+// Decrypt 根据密文中的密钥ID解密
+func (r *Keyring) Decrypt(data, associatedData []byte) ([]byte, error) {
+	envelope, err := ParseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	key, err := r.key(envelope.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	return key.open(envelope, associatedData)
+}
+
+// Rewrap 密文不是使用当前密钥加密时重新加密，changed表示是否需要保存新的密文
+func (r *Keyring) Rewrap(data, associatedData []byte) (result []byte, changed bool, err error) {
+	envelope, err := ParseEnvelope(data)
+	if err != nil {
+		return nil, false, err
+	}
+	if envelope.KeyID == r.Active() {
+		return data, false, nil
+	}
+	plaintext, err := r.Decrypt(data, associatedData)
+	if err != nil {
+		return nil, false, err
+	}
+	if result, err = r.Encrypt(plaintext, associatedData); err != nil {
+		return nil, false, err
+	}
+	return result, true, nil
+}
+
+// EncryptString 加密并使用base64 URL编码，用于保存到文本字段
+func (r *Keyring) EncryptString(plaintext string, associatedData []byte) (string, error) {
+	data, err := r.Encrypt([]byte(plaintext), associatedData)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecryptString 解密EncryptString生成的文本
+func (r *Keyring) DecryptString(ciphertext string, associatedData []byte) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", ErrEnvelopeInvalid
+	}
+	plaintext, err := r.Decrypt(data, associatedData)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,68 @@
+package security
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestKeyringRotate(t *testing.T) {
+	old, _ := GenerateSymmetricKey("2023", AlgorithmAES256GCM)
+	current, _ := GenerateSymmetricKey("2024", AlgorithmChaCha20Poly1305)
+	keyring, err := NewKeyringFromConfig(KeyringConfig{Active: "2023", Keys: []SymmetricKeyConfig{
+		{ID: old.ID, Secret: base64.StdEncoding.EncodeToString(old.Secret)},
+		{ID: current.ID, Algorithm: current.Algorithm, Secret: base64.StdEncoding.EncodeToString(current.Secret)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ad := []byte("account:1")
+	encrypted, err := keyring.Encrypt([]byte("this is aead test raw data"), ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = keyring.Decrypt(encrypted, []byte("account:2")); !errors.Is(err, ErrDecryptFailed) {
+		t.Fatalf("expected decrypt failed with other associated data, got %v", err)
+	}
+	if err = keyring.SetActive("2024"); err != nil {
+		t.Fatal(err)
+	}
+	rewrapped, changed, err := keyring.Rewrap(encrypted, ad)
+	if err != nil || !changed {
+		t.Fatalf("rewrap changed: %v, err: %v", changed, err)
+	}
+	envelope, err := ParseEnvelope(rewrapped)
+	if err != nil || envelope.KeyID != "2024" || envelope.Algorithm != AlgorithmChaCha20Poly1305 {
+		t.Fatalf("envelope: %+v, err: %v", envelope, err)
+	}
+	decrypted, err := keyring.Decrypt(rewrapped, ad)
+	if err != nil || string(decrypted) != "this is aead test raw data" {
+		t.Fatalf("decrypted: %s, err: %v", decrypted, err)
+	}
+}
+
+func TestEnvelopeHeaderAuthenticated(t *testing.T) {
+	key, _ := GenerateSymmetricKey("2024", AlgorithmAES256GCM)
+	keyring := NewKeyring()
+	renamed := key
+	renamed.ID = "2025"
+	if err := keyring.Add(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Add(renamed); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.SetActive(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := keyring.Encrypt([]byte("raw"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, _ := ParseEnvelope(encrypted)
+	envelope.KeyID = renamed.ID
+	tampered, _ := envelope.Marshal()
+	if _, err = keyring.Decrypt(tampered, nil); !errors.Is(err, ErrDecryptFailed) {
+		t.Fatalf("expected decrypt failed with tampered key id, got %v", err)
+	}
+}
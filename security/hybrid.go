@@ -0,0 +1,382 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"io"
+	"sync"
+)
+
+const (
+	WrapAlgorithmRSAOAEP256 = "RSA-OAEP-256"
+	WrapAlgorithmA256GCMKW  = "A256GCMKW"
+	WrapAlgorithmC20PKW     = "C20PKW"
+	WrapAlgorithmKMS        = "KMS"
+
+	// HybridVersion 当前的混合加密容器版本
+	HybridVersion byte = 1
+)
+
+var (
+	hybridMagic         = []byte("EH")
+	keyWrapLabel        = []byte("efucloud-key-wrap")
+	ErrKeyWrapper       = errors.New("key wrapper not found")
+	ErrHybridCiphertext = errors.New("hybrid ciphertext is invalid")
+)
+
+// KeyWrapper 加密及解密数据密钥，如本地RSA密钥、本地AES主密钥或者KMS
+type KeyWrapper interface {
+	KeyID() string
+	Algorithm() string
+	WrapKey(ctx context.Context, dataKey []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error)
+}
+
+// RSAKeyWrapper 使用RSA-OAEP-256加密数据密钥，只加密时可以不设置PrivateKey
+type RSAKeyWrapper struct {
+	ID         string
+	PublicKey  *rsa.PublicKey
+	PrivateKey *rsa.PrivateKey
+}
+
+func (w RSAKeyWrapper) KeyID() string {
+	return w.ID
+}
+
+func (w RSAKeyWrapper) Algorithm() string {
+	return WrapAlgorithmRSAOAEP256
+}
+
+func (w RSAKeyWrapper) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	publicKey := w.PublicKey
+	if publicKey == nil && w.PrivateKey != nil {
+		publicKey = &w.PrivateKey.PublicKey
+	}
+	if publicKey == nil {
+		return nil, ErrPublicKeyEmpty
+	}
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, dataKey, keyWrapLabel)
+}
+
+func (w RSAKeyWrapper) UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error) {
+	if w.PrivateKey == nil {
+		return nil, ErrPrivateKeyEmpty
+	}
+	return rsa.DecryptOAEP(sha256.New(), rand.Reader, w.PrivateKey, wrappedKey, keyWrapLabel)
+}
+
+// AESKeyWrapper 使用本地主密钥（AES-256-GCM或者ChaCha20-Poly1305）加密数据密钥
+type AESKeyWrapper struct {
+	Key SymmetricKey
+}
+
+func (w AESKeyWrapper) KeyID() string {
+	return w.Key.ID
+}
+
+// Algorithm 根据主密钥的算法返回A256GCMKW或者C20PKW
+func (w AESKeyWrapper) Algorithm() string {
+	if w.Key.Algorithm == AlgorithmChaCha20Poly1305 {
+		return WrapAlgorithmC20PKW
+	}
+	return WrapAlgorithmA256GCMKW
+}
+
+func (w AESKeyWrapper) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	return w.Key.Encrypt(dataKey, keyWrapLabel)
+}
+
+func (w AESKeyWrapper) UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error) {
+	envelope, err := ParseEnvelope(wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	return w.Key.open(envelope, keyWrapLabel)
+}
+
+// KMSClient 密钥管理服务，密钥不离开服务端
+type KMSClient interface {
+	Encrypt(ctx context.Context, keyID string, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error)
+}
+
+// KMSKeyWrapper 使用KMS加密数据密钥
+type KMSKeyWrapper struct {
+	Client KMSClient
+	ID     string
+}
+
+func (w KMSKeyWrapper) KeyID() string {
+	return w.ID
+}
+
+func (w KMSKeyWrapper) Algorithm() string {
+	return WrapAlgorithmKMS
+}
+
+func (w KMSKeyWrapper) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	return w.Client.Encrypt(ctx, w.ID, dataKey)
+}
+
+func (w KMSKeyWrapper) UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error) {
+	return w.Client.Decrypt(ctx, w.ID, wrappedKey)
+}
+
+// MemoryKMS 使用本地密钥模拟的KMS，用于测试及开发环境
+type MemoryKMS struct {
+	mutex sync.RWMutex
+	keys  map[string]SymmetricKey
+}
+
+func NewMemoryKMS() *MemoryKMS {
+	return &MemoryKMS{keys: make(map[string]SymmetricKey)}
+}
+
+// CreateKey 创建主密钥
+func (k *MemoryKMS) CreateKey(keyID string) error {
+	key, err := GenerateSymmetricKey(keyID, AlgorithmAES256GCM)
+	if err != nil {
+		return err
+	}
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.keys[keyID] = key
+	return nil
+}
+
+func (k *MemoryKMS) key(keyID string) (SymmetricKey, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	key, exist := k.keys[keyID]
+	if !exist {
+		return key, fmt.Errorf("%w: %s", ErrSymmetricKeyMissing, keyID)
+	}
+	return key, nil
+}
+
+func (k *MemoryKMS) Encrypt(ctx context.Context, keyID string, plaintext []byte) ([]byte, error) {
+	key, err := k.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return AESKeyWrapper{Key: key}.WrapKey(ctx, plaintext)
+}
+
+func (k *MemoryKMS) Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	key, err := k.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return AESKeyWrapper{Key: key}.UnwrapKey(ctx, ciphertext)
+}
+
+// HybridContainer 混合加密容器：EH|版本|算法长度|算法|密钥ID长度|密钥ID|数据密钥长度(2字节)|加密的数据密钥|随机数|密文，
+// 随机数之前的部分作为AES-GCM的关联数据
+type HybridContainer struct {
+	Version    byte
+	Algorithm  string
+	KeyID      string
+	WrappedKey []byte
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+func (c HybridContainer) header() ([]byte, error) {
+	if len(c.Algorithm) > 255 || len(c.KeyID) > 255 || len(c.WrappedKey) > 0xffff {
+		return nil, ErrHybridCiphertext
+	}
+	var buff bytes.Buffer
+	buff.Write(hybridMagic)
+	buff.WriteByte(c.Version)
+	buff.WriteByte(byte(len(c.Algorithm)))
+	buff.WriteString(c.Algorithm)
+	buff.WriteByte(byte(len(c.KeyID)))
+	buff.WriteString(c.KeyID)
+	_ = binary.Write(&buff, binary.BigEndian, uint16(len(c.WrappedKey)))
+	buff.Write(c.WrappedKey)
+	return buff.Bytes(), nil
+}
+
+func (c HybridContainer) Marshal() ([]byte, error) {
+	header, err := c.header()
+	if err != nil {
+		return nil, err
+	}
+	return append(append(header, c.Nonce...), c.Ciphertext...), nil
+}
+
+// IsHybridCiphertext 是否为HybridContainer格式的密文
+func IsHybridCiphertext(data []byte) bool {
+	return len(data) > len(hybridMagic) && bytes.HasPrefix(data, hybridMagic) && data[len(hybridMagic)] == HybridVersion
+}
+
+// ParseHybridContainer 解析HybridContainer.Marshal生成的密文
+func ParseHybridContainer(data []byte) (container HybridContainer, err error) {
+	if !IsHybridCiphertext(data) {
+		return container, ErrHybridCiphertext
+	}
+	container.Version = data[len(hybridMagic)]
+	reader := bytes.NewReader(data[len(hybridMagic)+1:])
+	readString := func() (string, error) {
+		length, err := reader.ReadByte()
+		if err != nil {
+			return "", ErrHybridCiphertext
+		}
+		buff := make([]byte, length)
+		if _, err = io.ReadFull(reader, buff); err != nil {
+			return "", ErrHybridCiphertext
+		}
+		return string(buff), nil
+	}
+	if container.Algorithm, err = readString(); err != nil {
+		return container, err
+	}
+	if container.KeyID, err = readString(); err != nil {
+		return container, err
+	}
+	var wrappedLength uint16
+	if err = binary.Read(reader, binary.BigEndian, &wrappedLength); err != nil {
+		return container, ErrHybridCiphertext
+	}
+	container.WrappedKey = make([]byte, wrappedLength)
+	container.Nonce = make([]byte, 12)
+	if _, err = io.ReadFull(reader, container.WrappedKey); err != nil {
+		return container, ErrHybridCiphertext
+	}
+	if _, err = io.ReadFull(reader, container.Nonce); err != nil {
+		return container, ErrHybridCiphertext
+	}
+	container.Ciphertext = make([]byte, reader.Len())
+	_, _ = reader.Read(container.Ciphertext)
+	return container, nil
+}
+
+// HybridEncrypt 生成一次性的数据密钥，使用AES-256-GCM加密数据，使用wrapper加密数据密钥
+func HybridEncrypt(ctx context.Context, wrapper KeyWrapper, plaintext, associatedData []byte) ([]byte, error) {
+	dataKey := make([]byte, SymmetricKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	wrappedKey, err := wrapper.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("wrap data key failed, err: %s", err.Error())
+	}
+	container := HybridContainer{Version: HybridVersion, Algorithm: wrapper.Algorithm(), KeyID: wrapper.KeyID(), WrappedKey: wrappedKey, Nonce: make([]byte, 12)}
+	if _, err = io.ReadFull(rand.Reader, container.Nonce); err != nil {
+		return nil, err
+	}
+	header, err := container.header()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	container.Ciphertext = aead.Seal(nil, container.Nonce, plaintext, append(header, associatedData...))
+	return container.Marshal()
+}
+
+// HybridDecrypt 根据密文中的算法及密钥ID选择wrapper解密
+func HybridDecrypt(ctx context.Context, data, associatedData []byte, wrappers ...KeyWrapper) ([]byte, error) {
+	container, err := ParseHybridContainer(data)
+	if err != nil {
+		return nil, err
+	}
+	var wrapper KeyWrapper
+	for _, item := range wrappers {
+		if item.Algorithm() == container.Algorithm && item.KeyID() == container.KeyID {
+			wrapper = item
+			break
+		}
+	}
+	if wrapper == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrKeyWrapper, container.Algorithm, container.KeyID)
+	}
+	dataKey, err := wrapper.UnwrapKey(ctx, container.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key failed, err: %s", err.Error())
+	}
+	header, err := container.header()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, container.Nonce, container.Ciphertext, append(header, associatedData...))
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != SymmetricKeySize {
+		return nil, ErrHybridCiphertext
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// HybridEncryptData EncryptData的混合加密版本，public为PEM格式的RSA公钥
+func HybridEncryptData(public, input []byte) ([]byte, error) {
+	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(public)
+	if err != nil {
+		return nil, err
+	}
+	return HybridEncrypt(context.Background(), RSAKeyWrapper{PublicKey: publicKey}, input, nil)
+}
+
+// HybridDecryptData DecryptData的混合加密版本，private为PEM格式的RSA私钥，兼容EncryptData生成的旧密文
+func HybridDecryptData(private, input []byte) ([]byte, error) {
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(private)
+	if err != nil {
+		return nil, err
+	}
+	return hybridDecryptRSA(privateKey, input)
+}
+
+// HybridEncrypt Encrypt的混合加密版本
+func (s *RsaSecurity) HybridEncrypt(input []byte) ([]byte, error) {
+	return HybridEncrypt(context.Background(), RSAKeyWrapper{PublicKey: s.publicKey}, input, nil)
+}
+
+// HybridDecrypt Decrypt的混合加密版本，兼容Encrypt生成的旧密文
+func (s *RsaSecurity) HybridDecrypt(input []byte) ([]byte, error) {
+	if s.privateKey == nil {
+		return nil, ErrPrivateKeyEmpty
+	}
+	return hybridDecryptRSA(s.privateKey, input)
+}
+
+// hybridDecryptRSA 旧的RSA-OAEP密文有极小的概率以混合加密的前缀开头，
+// 混合加密解密失败且长度为模数长度的整数倍时按旧密文解密
+func hybridDecryptRSA(privateKey *rsa.PrivateKey, input []byte) ([]byte, error) {
+	if !IsHybridCiphertext(input) {
+		return DecryptDataByPrivateKey(privateKey, input)
+	}
+	plaintext, err := HybridDecrypt(context.Background(), input, nil, RSAKeyWrapper{PrivateKey: privateKey})
+	if err == nil {
+		return plaintext, nil
+	}
+	if len(input)%privateKey.Size() == 0 {
+		if legacy, er := DecryptDataByPrivateKey(privateKey, input); er == nil {
+			return legacy, nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,83 @@
+package security
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHybridEncryptData(t *testing.T) {
+	private, public, _ := GenerateRASPrivateAndPublicKeys()
+	data := strings.Repeat("this is hybrid test raw data", 100)
+	encrypted, err := HybridEncryptData(public, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := HybridDecryptData(private, encrypted)
+	if err != nil || string(decrypted) != data {
+		t.Fatalf("hybrid decrypt failed, err: %v", err)
+	}
+	legacy, _ := EncryptData(public, []byte("legacy"))
+	if decrypted, err = HybridDecryptData(private, legacy); err != nil || string(decrypted) != "legacy" {
+		t.Fatalf("legacy decrypt failed, err: %v", err)
+	}
+}
+
+func TestHybridKMS(t *testing.T) {
+	kms := NewMemoryKMS()
+	if err := kms.CreateKey("master"); err != nil {
+		t.Fatal(err)
+	}
+	wrapper := KMSKeyWrapper{Client: kms, ID: "master"}
+	encrypted, err := HybridEncrypt(context.Background(), wrapper, []byte("secret"), []byte("tenant:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = HybridDecrypt(context.Background(), encrypted, []byte("tenant:2"), wrapper); err == nil {
+		t.Fatal("expected error with other associated data")
+	}
+	decrypted, err := HybridDecrypt(context.Background(), encrypted, []byte("tenant:1"), wrapper)
+	if err != nil || string(decrypted) != "secret" {
+		t.Fatalf("decrypted: %s, err: %v", decrypted, err)
+	}
+}
+
+func TestAESKeyWrapperAlgorithm(t *testing.T) {
+	aesKey, _ := GenerateSymmetricKey("master", AlgorithmAES256GCM)
+	chachaKey, _ := GenerateSymmetricKey("master", AlgorithmChaCha20Poly1305)
+	if algorithm := (AESKeyWrapper{Key: aesKey}).Algorithm(); algorithm != WrapAlgorithmA256GCMKW {
+		t.Fatalf("aes wrapper algorithm: %s", algorithm)
+	}
+	wrapper := AESKeyWrapper{Key: chachaKey}
+	if algorithm := wrapper.Algorithm(); algorithm != WrapAlgorithmC20PKW {
+		t.Fatalf("chacha20 wrapper algorithm: %s", algorithm)
+	}
+	encrypted, err := HybridEncrypt(context.Background(), wrapper, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if container, _ := ParseHybridContainer(encrypted); container.Algorithm != WrapAlgorithmC20PKW {
+		t.Fatalf("container algorithm: %s", container.Algorithm)
+	}
+	if decrypted, err := HybridDecrypt(context.Background(), encrypted, nil, wrapper); err != nil || string(decrypted) != "secret" {
+		t.Fatalf("decrypted: %s, err: %v", decrypted, err)
+	}
+}
+
+func TestHybridDecryptLegacyPrefix(t *testing.T) {
+	private, public, _ := GenerateRASPrivateAndPublicKeys()
+	rsaSecurity, err := NewRsaSecurityFromStringKey(string(public), string(private))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 以混合加密前缀开头但无法解析的数据，按旧密文解密仍然失败时返回混合加密的错误
+	input := append(append([]byte{}, hybridMagic...), HybridVersion)
+	input = append(input, make([]byte, 256-len(input))...)
+	if _, err = rsaSecurity.HybridDecrypt(input); !errors.Is(err, ErrKeyWrapper) {
+		t.Fatalf("expected key wrapper error, got %v", err)
+	}
+	if _, err = NewRsaSecurityFromRsaKey(nil, nil).HybridDecrypt(input); !errors.Is(err, ErrPrivateKeyEmpty) {
+		t.Fatalf("expected empty private key, got %v", err)
+	}
+}
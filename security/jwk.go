@@ -0,0 +1,276 @@
+package security
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	KeyTypeRSA = "RSA"
+	KeyTypeEC  = "EC"
+	KeyTypeOKP = "OKP"
+)
+
+// JSONWebKey RFC 7517 JWK
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	// 私钥，EC及OKP只有D
+	D  string `json:"d,omitempty"`
+	P  string `json:"p,omitempty"`
+	Q  string `json:"q,omitempty"`
+	DP string `json:"dp,omitempty"`
+	DQ string `json:"dq,omitempty"`
+	QI string `json:"qi,omitempty"`
+}
+
+// JSONWebKeySet RFC 7517 JWKS
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// Key 根据kid查找JWK
+func (s JSONWebKeySet) Key(kid string) (keys []JSONWebKey) {
+	for _, key := range s.Keys {
+		if key.Kid == kid {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// NewJSONWebKeySet 将公钥转换为JWKS，kid使用RFC 7638指纹
+func NewJSONWebKeySet(publicKeys ...crypto.PublicKey) (set JSONWebKeySet, err error) {
+	set.Keys = make([]JSONWebKey, 0, len(publicKeys))
+	for _, publicKey := range publicKeys {
+		jwk, err := NewJSONWebKey(publicKey, "", "")
+		if err != nil {
+			return set, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
+
+// NewJSONWebKey 将公钥转换为JWK，支持RSA、ECDSA(P-256/P-384/P-521)及Ed25519，kid为空时使用RFC 7638指纹
+func NewJSONWebKey(publicKey crypto.PublicKey, kid, alg string) (jwk JSONWebKey, err error) {
+	defer func() {
+		if err == nil && len(jwk.Kid) == 0 {
+			jwk.Kid, err = jwk.Thumbprint()
+		}
+	}()
+	jwk.Kid = kid
+	jwk.Alg = alg
+	jwk.Use = "sig"
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = KeyTypeRSA
+		jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.Kty = KeyTypeEC
+		jwk.Crv = key.Curve.Params().Name
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk.X = base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = KeyTypeOKP
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key)
+	default:
+		return jwk, fmt.Errorf("unsupported public key type: %T", publicKey)
+	}
+	return jwk, nil
+}
+
+// PublicKey 将JWK转换为公钥，返回*rsa.PublicKey、*ecdsa.PublicKey或ed25519.PublicKey
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case KeyTypeRSA:
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %s decode n failed, err: %s", k.Kid, err.Error())
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("jwk %s decode e failed", k.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case KeyTypeEC:
+		curve, err := ellipticCurve(k.Crv)
+		if err != nil {
+			return nil, err
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %s decode x failed, err: %s", k.Kid, err.Error())
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %s decode y failed, err: %s", k.Kid, err.Error())
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("jwk %s point is not on curve %s", k.Kid, k.Crv)
+		}
+		return key, nil
+	case KeyTypeOKP:
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("jwk %s unsupported curve: %s", k.Kid, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("jwk %s decode x failed", k.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, errors.New("unsupported jwk key type: " + k.Kty)
+}
+
+// NewPrivateJSONWebKey 将私钥转换为JWK，kid为空时使用公钥的RFC 7638指纹
+func NewPrivateJSONWebKey(privateKey crypto.Signer, kid, alg string) (jwk JSONWebKey, err error) {
+	if jwk, err = NewJSONWebKey(privateKey.Public(), kid, alg); err != nil {
+		return jwk, err
+	}
+	encode := base64.RawURLEncoding.EncodeToString
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if len(key.Primes) != 2 {
+			return jwk, errors.New("multi-prime rsa key is not supported")
+		}
+		key.Precompute()
+		jwk.D = encode(key.D.Bytes())
+		jwk.P = encode(key.Primes[0].Bytes())
+		jwk.Q = encode(key.Primes[1].Bytes())
+		jwk.DP = encode(key.Precomputed.Dp.Bytes())
+		jwk.DQ = encode(key.Precomputed.Dq.Bytes())
+		jwk.QI = encode(key.Precomputed.Qinv.Bytes())
+	case *ecdsa.PrivateKey:
+		jwk.D = encode(key.D.FillBytes(make([]byte, (key.Curve.Params().BitSize+7)/8)))
+	case ed25519.PrivateKey:
+		jwk.D = encode(key.Seed())
+	default:
+		return jwk, fmt.Errorf("unsupported private key type: %T", privateKey)
+	}
+	return jwk, nil
+}
+
+// PrivateKey 将包含私钥的JWK转换为私钥，返回*rsa.PrivateKey、*ecdsa.PrivateKey或ed25519.PrivateKey
+func (k JSONWebKey) PrivateKey() (crypto.Signer, error) {
+	if len(k.D) == 0 {
+		return nil, fmt.Errorf("jwk %s has no private key", k.Kid)
+	}
+	publicKey, err := k.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	decode := func(name, value string) (*big.Int, error) {
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(data) == 0 {
+			return nil, fmt.Errorf("jwk %s decode %s failed", k.Kid, name)
+		}
+		return new(big.Int).SetBytes(data), nil
+	}
+	d, err := decode("d", k.D)
+	if err != nil {
+		return nil, err
+	}
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		p, err := decode("p", k.P)
+		if err != nil {
+			return nil, err
+		}
+		q, err := decode("q", k.Q)
+		if err != nil {
+			return nil, err
+		}
+		privateKey := &rsa.PrivateKey{PublicKey: *key, D: d, Primes: []*big.Int{p, q}}
+		if err = privateKey.Validate(); err != nil {
+			return nil, fmt.Errorf("jwk %s rsa key is invalid, err: %s", k.Kid, err.Error())
+		}
+		privateKey.Precompute()
+		return privateKey, nil
+	case *ecdsa.PublicKey:
+		// RFC 7518 第6.2.2.1节，d的长度必须与曲线的阶长度相同，NewPrivateKey会拒绝0及大于等于N的值
+		publicECDH, err := key.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("jwk %s ec key is invalid, err: %s", k.Kid, err.Error())
+		}
+		raw, _ := base64.RawURLEncoding.DecodeString(k.D)
+		if len(raw) != (key.Curve.Params().BitSize+7)/8 {
+			return nil, fmt.Errorf("jwk %s decode d failed", k.Kid)
+		}
+		privateECDH, err := publicECDH.Curve().NewPrivateKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %s ec key is invalid, err: %s", k.Kid, err.Error())
+		}
+		if !privateECDH.PublicKey().Equal(publicECDH) {
+			return nil, fmt.Errorf("jwk %s d does not match public key", k.Kid)
+		}
+		return &ecdsa.PrivateKey{PublicKey: *key, D: d}, nil
+	case ed25519.PublicKey:
+		seed, _ := base64.RawURLEncoding.DecodeString(k.D)
+		if len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("jwk %s decode d failed", k.Kid)
+		}
+		privateKey := ed25519.NewKeyFromSeed(seed)
+		if !key.Equal(privateKey.Public()) {
+			return nil, fmt.Errorf("jwk %s d does not match public key", k.Kid)
+		}
+		return privateKey, nil
+	}
+	return nil, errors.New("unsupported jwk key type: " + k.Kty)
+}
+
+// Public 去掉私钥部分的JWK
+func (k JSONWebKey) Public() JSONWebKey {
+	k.D, k.P, k.Q, k.DP, k.DQ, k.QI = "", "", "", "", "", ""
+	return k
+}
+
+// Thumbprint RFC 7638 JWK指纹，使用SHA-256并以base64url编码
+func (k JSONWebKey) Thumbprint() (string, error) {
+	var members string
+	switch k.Kty {
+	case KeyTypeRSA:
+		members = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, k.E, k.Kty, k.N)
+	case KeyTypeEC:
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, k.Crv, k.Kty, k.X, k.Y)
+	case KeyTypeOKP:
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, k.Crv, k.Kty, k.X)
+	default:
+		return "", errors.New("unsupported jwk key type: " + k.Kty)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func ellipticCurve(name string) (elliptic.Curve, error) {
+	switch name {
+	case "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	}
+	return nil, errors.New("unsupported elliptic curve: " + name)
+}
@@ -0,0 +1,292 @@
+package security
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+const (
+	KeyAlgorithmRSA2048 = "RSA-2048"
+	KeyAlgorithmRSA3072 = "RSA-3072"
+	KeyAlgorithmRSA4096 = "RSA-4096"
+	KeyAlgorithmP256    = "EC-P256"
+	KeyAlgorithmP384    = "EC-P384"
+	KeyAlgorithmP521    = "EC-P521"
+	KeyAlgorithmEd25519 = "Ed25519"
+)
+
+const (
+	PEMFormatPKCS8 = "PKCS8"
+	PEMFormatPKCS1 = "PKCS1"
+	PEMFormatSEC1  = "SEC1"
+
+	// DefaultPBKDF2Iterations 加密私钥时PBKDF2-HMAC-SHA256的迭代次数
+	DefaultPBKDF2Iterations = 600000
+	// MaxPBKDF2Iterations 解密私钥时允许的最大迭代次数，避免构造的PEM消耗过多CPU
+	MaxPBKDF2Iterations = 10 * DefaultPBKDF2Iterations
+)
+
+var (
+	ErrPrivateKeyEncrypted = errors.New("private key is encrypted")
+	ErrPassphraseInvalid   = errors.New("passphrase is invalid or private key is corrupted")
+)
+
+// GenerateKey 生成RSA、ECDSA或者Ed25519私钥，algorithm为KeyAlgorithm常量
+func GenerateKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case KeyAlgorithmRSA2048:
+		return GenerateRSAKey(2048)
+	case KeyAlgorithmRSA3072:
+		return GenerateRSAKey(3072)
+	case KeyAlgorithmRSA4096:
+		return GenerateRSAKey(4096)
+	case KeyAlgorithmP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyAlgorithmP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyAlgorithmP521:
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case KeyAlgorithmEd25519:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	}
+	return nil, fmt.Errorf("unsupported key algorithm: %s", algorithm)
+}
+
+// GenerateRSAKey 生成RSA私钥，bits只支持2048、3072、4096
+func GenerateRSAKey(bits int) (*rsa.PrivateKey, error) {
+	if bits != 2048 && bits != 3072 && bits != 4096 {
+		return nil, fmt.Errorf("unsupported rsa key size: %d", bits)
+	}
+	return rsa.GenerateKey(rand.Reader, bits)
+}
+
+// EncodePrivateKeyPEM 将私钥编码为PEM，format为空时使用PKCS#8，PKCS#1只支持RSA，SEC1只支持ECDSA
+func EncodePrivateKeyPEM(privateKey crypto.Signer, format string) ([]byte, error) {
+	var block *pem.Block
+	switch format {
+	case PEMFormatPKCS8, "":
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		block = &pem.Block{Type: PEMTypePrivateKey, Bytes: der}
+	case PEMFormatPKCS1:
+		key, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("pkcs1 does not support %T", privateKey)
+		}
+		block = &pem.Block{Type: PEMTypeRSAPrivateKey, Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	case PEMFormatSEC1:
+		key, ok := privateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("sec1 does not support %T", privateKey)
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		block = &pem.Block{Type: PEMTypeECPrivateKey, Bytes: der}
+	default:
+		return nil, fmt.Errorf("unsupported private key format: %s", format)
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// EncodePublicKeyPEM 将公钥编码为PKIX格式的PEM
+func EncodePublicKeyPEM(publicKey crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMTypePublicKey, Bytes: der}), nil
+}
+
+// EncodeRSAPublicKeyPEM 将RSA公钥编码为PKCS#1格式的PEM
+func EncodeRSAPublicKeyPEM(publicKey *rsa.PublicKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: PEMTypeRSAPublicKey, Bytes: x509.MarshalPKCS1PublicKey(publicKey)})
+}
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// RFC 5958 EncryptedPrivateKeyInfo及RFC 8018 PBES2参数
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+func algorithmIdentifier(oid asn1.ObjectIdentifier, params interface{}) (pkix.AlgorithmIdentifier, error) {
+	der, err := asn1.Marshal(params)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	return pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.RawValue{FullBytes: der}}, nil
+}
+
+// EncryptPrivateKeyPEM 使用口令加密私钥，格式为PKCS#8 ENCRYPTED PRIVATE KEY（PBES2、PBKDF2-HMAC-SHA256、AES-256-CBC），
+// 与openssl pkcs8兼容
+func EncryptPrivateKeyPEM(privateKey crypto.Signer, passphrase []byte) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	salt, iv := make([]byte, 16), make([]byte, aes.BlockSize)
+	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	if _, err = io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	key, err := pbkdf2.Key(sha256.New, string(passphrase), salt, DefaultPBKDF2Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(der)%aes.BlockSize
+	encrypted := append(der, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	prf := pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue}
+	kdf, err := algorithmIdentifier(oidPBKDF2, pbkdf2Params{Salt: salt, Iterations: DefaultPBKDF2Iterations, PRF: prf})
+	if err != nil {
+		return nil, err
+	}
+	scheme, err := algorithmIdentifier(oidAES256CBC, iv)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := algorithmIdentifier(oidPBES2, pbes2Params{KeyDerivationFunc: kdf, EncryptionScheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+	info, err := asn1.Marshal(encryptedPrivateKeyInfo{Algorithm: algorithm, EncryptedData: encrypted})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMTypeEncryptedPrivateKey, Bytes: info}), nil
+}
+
+// DecryptPrivateKeyPEM 解密EncryptPrivateKeyPEM或者openssl生成的PBES2加密私钥，未加密的私钥直接解析
+func DecryptPrivateKeyPEM(data, passphrase []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrNotPEM
+	}
+	if block.Type != PEMTypeEncryptedPrivateKey {
+		return ParsePrivateKeyPEM(data)
+	}
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(block.Bytes, &info); err != nil {
+		return nil, fmt.Errorf("parse encrypted private key failed, err: %s", err.Error())
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption: %s", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("parse pbes2 params failed, err: %s", err.Error())
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function: %s", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("parse pbkdf2 params failed, err: %s", err.Error())
+	}
+	var hashFunc func() hash.Hash
+	switch {
+	case len(kdf.PRF.Algorithm) == 0 || kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		hashFunc = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		hashFunc = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported pbkdf2 prf: %s", kdf.PRF.Algorithm)
+	}
+	var keyLength int
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		keyLength = 16
+	case params.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+		keyLength = 24
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		keyLength = 32
+	default:
+		return nil, fmt.Errorf("unsupported encryption scheme: %s", params.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("parse encryption iv failed")
+	}
+	if kdf.Iterations > MaxPBKDF2Iterations {
+		return nil, fmt.Errorf("pbkdf2 iterations %d exceeds %d", kdf.Iterations, MaxPBKDF2Iterations)
+	}
+	if kdf.Iterations <= 0 || len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, ErrPassphraseInvalid
+	}
+	key, err := pbkdf2.Key(hashFunc, string(passphrase), kdf.Salt, kdf.Iterations, keyLength)
+	if err != nil {
+		return nil, err
+	}
+	aesBlock, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	der := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(aesBlock, iv).CryptBlocks(der, info.EncryptedData)
+	padding := int(der[len(der)-1])
+	if padding == 0 || padding > aes.BlockSize ||
+		!hmac.Equal(der[len(der)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, ErrPassphraseInvalid
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(der[:len(der)-padding])
+	if err != nil {
+		return nil, ErrPassphraseInvalid
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type: %T", privateKey)
+	}
+	return signer, nil
+}
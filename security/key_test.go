@@ -0,0 +1,140 @@
+package security
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/ecdsa"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestPrivateKeyConversion(t *testing.T) {
+	for _, algorithm := range []string{KeyAlgorithmRSA2048, KeyAlgorithmP256, KeyAlgorithmEd25519} {
+		key, err := GenerateKey(algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jwk, err := NewPrivateJSONWebKey(key, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		privateKey, err := jwk.PrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !key.(interface{ Equal(crypto.PrivateKey) bool }).Equal(privateKey) {
+			t.Fatalf("%s: jwk private key mismatch", algorithm)
+		}
+		encrypted, err := EncryptPrivateKeyPEM(key, []byte("passphrase"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = ParsePrivateKeyPEM(encrypted); !errors.Is(err, ErrPrivateKeyEncrypted) {
+			t.Fatalf("%s: expected encrypted error, got %v", algorithm, err)
+		}
+		if _, err = DecryptPrivateKeyPEM(encrypted, []byte("wrong")); !errors.Is(err, ErrPassphraseInvalid) {
+			t.Fatalf("%s: expected passphrase error, got %v", algorithm, err)
+		}
+		decrypted, err := DecryptPrivateKeyPEM(encrypted, []byte("passphrase"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !key.(interface{ Equal(crypto.PrivateKey) bool }).Equal(decrypted) {
+			t.Fatalf("%s: decrypted private key mismatch", algorithm)
+		}
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// RFC 7638 第3.1节的示例
+	jwk := JSONWebKey{Kty: KeyTypeRSA, E: "AQAB",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"}
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil || thumbprint != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Fatalf("thumbprint: %s, err: %v", thumbprint, err)
+	}
+}
+
+func TestPrivateKeyPEM(t *testing.T) {
+	rsaKey, _ := GenerateKey(KeyAlgorithmRSA2048)
+	ecKey, _ := GenerateKey(KeyAlgorithmP256)
+	edKey, _ := GenerateKey(KeyAlgorithmEd25519)
+	cases := []struct {
+		format string
+		key    crypto.Signer
+		typ    string
+	}{
+		{format: PEMFormatPKCS8, key: rsaKey, typ: PEMTypePrivateKey},
+		{format: PEMFormatPKCS8, key: ecKey, typ: PEMTypePrivateKey},
+		{format: PEMFormatPKCS8, key: edKey, typ: PEMTypePrivateKey},
+		{format: PEMFormatPKCS1, key: rsaKey, typ: PEMTypeRSAPrivateKey},
+		{format: PEMFormatSEC1, key: ecKey, typ: PEMTypeECPrivateKey},
+	}
+	for _, c := range cases {
+		data, err := EncodePrivateKeyPEM(c.key, c.format)
+		if err != nil {
+			t.Fatalf("%s %T: %v", c.format, c.key, err)
+		}
+		if block, _ := pem.Decode(data); block == nil || block.Type != c.typ {
+			t.Fatalf("%s %T: unexpected pem block", c.format, c.key)
+		}
+		parsed, err := ParsePrivateKeyPEM(data)
+		if err != nil {
+			t.Fatalf("%s %T: %v", c.format, c.key, err)
+		}
+		if !c.key.(interface{ Equal(crypto.PrivateKey) bool }).Equal(parsed) {
+			t.Fatalf("%s %T: parsed private key mismatch", c.format, c.key)
+		}
+	}
+	for _, c := range []struct {
+		format string
+		key    crypto.Signer
+	}{{PEMFormatPKCS1, ecKey}, {PEMFormatPKCS1, edKey}, {PEMFormatSEC1, rsaKey}, {PEMFormatSEC1, edKey}} {
+		if _, err := EncodePrivateKeyPEM(c.key, c.format); err == nil {
+			t.Fatalf("%s %T: expected unsupported error", c.format, c.key)
+		}
+	}
+}
+
+func TestECPrivateKeyInvalid(t *testing.T) {
+	key, _ := GenerateKey(KeyAlgorithmP256)
+	jwk, err := NewPrivateJSONWebKey(key, "k1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := key.(*ecdsa.PrivateKey).Curve.Params().N
+	for _, d := range [][]byte{
+		make([]byte, 32),
+		order.FillBytes(make([]byte, 32)),
+		new(big.Int).Add(order, big.NewInt(1)).FillBytes(make([]byte, 32)),
+		append([]byte{1}, make([]byte, 32)...),
+		{1},
+	} {
+		invalid := jwk
+		invalid.D = base64.RawURLEncoding.EncodeToString(d)
+		if _, err = invalid.PrivateKey(); err == nil {
+			t.Fatalf("expected invalid d %x", d)
+		}
+	}
+}
+
+func TestDecryptPrivateKeyIterations(t *testing.T) {
+	kdf, _ := algorithmIdentifier(oidPBKDF2, pbkdf2Params{Salt: make([]byte, 16), Iterations: MaxPBKDF2Iterations + 1,
+		PRF: pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue}})
+	scheme, _ := algorithmIdentifier(oidAES256CBC, make([]byte, aes.BlockSize))
+	algorithm, _ := algorithmIdentifier(oidPBES2, pbes2Params{KeyDerivationFunc: kdf, EncryptionScheme: scheme})
+	info, err := asn1.Marshal(encryptedPrivateKeyInfo{Algorithm: algorithm, EncryptedData: make([]byte, aes.BlockSize)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: PEMTypeEncryptedPrivateKey, Bytes: info})
+	if _, err = DecryptPrivateKeyPEM(data, []byte("passphrase")); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("expected iterations error, got %v", err)
+	}
+}
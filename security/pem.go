@@ -0,0 +1,70 @@
+package security
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+const (
+	PEMTypePrivateKey    = "PRIVATE KEY"
+	PEMTypeRSAPrivateKey = "RSA PRIVATE KEY"
+	PEMTypeECPrivateKey  = "EC PRIVATE KEY"
+	PEMTypePublicKey     = "PUBLIC KEY"
+	PEMTypeRSAPublicKey  = "RSA PUBLIC KEY"
+	PEMTypeCertificate   = "CERTIFICATE"
+
+	PEMTypeEncryptedPrivateKey = "ENCRYPTED PRIVATE KEY"
+)
+
+var ErrNotPEM = errors.New("data is not pem encoded")
+
+// ParsePrivateKeyPEM 解析PKCS#1、SEC1及PKCS#8格式的私钥，不依赖PEM的类型标签，加密的私钥使用DecryptPrivateKeyPEM
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrNotPEM
+	}
+	if block.Type == PEMTypeEncryptedPrivateKey {
+		return nil, ErrPrivateKeyEncrypted
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type: %T", key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("parse %s failed, unsupported private key format", block.Type)
+}
+
+// ParsePublicKeyPEM 解析PKIX、PKCS#1格式的公钥及证书，兼容GenerateRASPrivateAndPublicKeys以前生成的RSA PUBLIC KEY标签的PKIX公钥
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrNotPEM
+	}
+	if block.Type == PEMTypeCertificate {
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse certificate failed, err: %s", err.Error())
+		}
+		return certificate.PublicKey, nil
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s failed, unsupported public key format", block.Type)
+	}
+	return key, nil
+}
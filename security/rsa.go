@@ -4,8 +4,6 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
-	"crypto/x509"
-	"encoding/pem"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -30,20 +28,18 @@ func NewRsaSecurityFromStringKey(publicPem, privatePem string) (result *RsaSecur
 	return
 }
 
+// GenerateRASPrivateAndPublicKeys 生成RSA-2048密钥，私钥为PKCS#1格式，公钥为PKIX格式，其它算法使用GenerateKey
 func GenerateRASPrivateAndPublicKeys() (privateKey, publicKey []byte, err error) {
-	pri, err := rsa.GenerateKey(rand.Reader, 2048)
+	pri, err := GenerateRSAKey(2048)
 	if err != nil {
 		return nil, nil, err
 	}
-	derTx := x509.MarshalPKCS1PrivateKey(pri)
-	block := pem.Block{Type: "RSA PRIVATE KEY", Bytes: derTx}
-	privateKey = pem.EncodeToMemory(&block)
-	stream, err := x509.MarshalPKIXPublicKey(&pri.PublicKey)
-	if err != nil {
+	if privateKey, err = EncodePrivateKeyPEM(pri, PEMFormatPKCS1); err != nil {
+		return nil, nil, err
+	}
+	if publicKey, err = EncodePublicKeyPEM(&pri.PublicKey); err != nil {
 		return nil, nil, err
 	}
-	block = pem.Block{Type: "RSA PUBLIC KEY", Bytes: stream}
-	publicKey = pem.EncodeToMemory(&block)
 	return privateKey, publicKey, nil
 }
 
@@ -0,0 +1,297 @@
+package security
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+)
+
+const (
+	SignAlgorithmPS256 = "PS256"
+	SignAlgorithmES256 = "ES256"
+	SignAlgorithmEdDSA = "EdDSA"
+)
+
+var (
+	ErrSignatureInvalid = errors.New("signature is invalid")
+	ErrJWSInvalid       = errors.New("jws is invalid")
+	ErrPrivateKeyEmpty  = errors.New("private key is empty")
+	ErrPublicKeyEmpty   = errors.New("public key is empty")
+)
+
+// SignAlgorithm 根据公钥返回签名算法：RSA使用PS256，ECDSA只支持P-256，Ed25519使用EdDSA
+func SignAlgorithm(publicKey crypto.PublicKey) (string, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return SignAlgorithmPS256, nil
+	case *ecdsa.PublicKey:
+		if key.Curve == elliptic.P256() {
+			return SignAlgorithmES256, nil
+		}
+		return "", fmt.Errorf("unsupported ecdsa curve: %s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return SignAlgorithmEdDSA, nil
+	}
+	return "", fmt.Errorf("unsupported public key type: %T", publicKey)
+}
+
+// Sign 签名，RSA使用PSS，ECDSA签名为JWS使用的r|s格式
+func Sign(privateKey crypto.Signer, data []byte) ([]byte, error) {
+	return signReader(privateKey, bytes.NewReader(data))
+}
+
+// Verify 校验Sign生成的签名
+func Verify(publicKey crypto.PublicKey, data, signature []byte) error {
+	return verifyReader(publicKey, bytes.NewReader(data), signature)
+}
+
+// signReader RSA、ECDSA流式计算摘要，Ed25519需要完整的数据，会读取到内存中
+func signReader(privateKey crypto.Signer, reader io.Reader) ([]byte, error) {
+	algorithm, err := SignAlgorithm(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	if algorithm == SignAlgorithmEdDSA {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		return privateKey.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	digest, err := sha256Reader(reader)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm == SignAlgorithmPS256 {
+		return privateKey.Sign(rand.Reader, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256})
+	}
+	der, err := privateKey.Sign(rand.Reader, digest, crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	var value struct{ R, S *big.Int }
+	if _, err = asn1.Unmarshal(der, &value); err != nil {
+		return nil, err
+	}
+	signature := make([]byte, 64)
+	value.R.FillBytes(signature[:32])
+	value.S.FillBytes(signature[32:])
+	return signature, nil
+}
+
+func verifyReader(publicKey crypto.PublicKey, reader io.Reader, signature []byte) error {
+	algorithm, err := SignAlgorithm(publicKey)
+	if err != nil {
+		return err
+	}
+	if algorithm == SignAlgorithmEdDSA {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(publicKey.(ed25519.PublicKey), data, signature) {
+			return ErrSignatureInvalid
+		}
+		return nil
+	}
+	digest, err := sha256Reader(reader)
+	if err != nil {
+		return err
+	}
+	if algorithm == SignAlgorithmPS256 {
+		if rsa.VerifyPSS(publicKey.(*rsa.PublicKey), crypto.SHA256, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) != nil {
+			return ErrSignatureInvalid
+		}
+		return nil
+	}
+	if len(signature) != 64 {
+		return ErrSignatureInvalid
+	}
+	r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(publicKey.(*ecdsa.PublicKey), digest, r, s) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
+
+func sha256Reader(reader io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, reader); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// SignatureKey 签名密钥，PrivateKey为空时只能验签
+type SignatureKey struct {
+	KeyID      string
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+// NewSignatureKeyFromPEM 从PEM格式的私钥加载签名密钥
+func NewSignatureKeyFromPEM(privatePem []byte, kid string) (*SignatureKey, error) {
+	privateKey, err := ParsePrivateKeyPEM(privatePem)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = SignAlgorithm(privateKey.Public()); err != nil {
+		return nil, err
+	}
+	return &SignatureKey{KeyID: kid, PrivateKey: privateKey, PublicKey: privateKey.Public()}, nil
+}
+
+// NewVerificationKeyFromPEM 从PEM格式的公钥或者证书加载验签密钥
+func NewVerificationKeyFromPEM(publicPem []byte, kid string) (*SignatureKey, error) {
+	publicKey, err := ParsePublicKeyPEM(publicPem)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = SignAlgorithm(publicKey); err != nil {
+		return nil, err
+	}
+	return &SignatureKey{KeyID: kid, PublicKey: publicKey}, nil
+}
+
+func (k *SignatureKey) Algorithm() string {
+	algorithm, _ := SignAlgorithm(k.PublicKey)
+	return algorithm
+}
+
+func (k *SignatureKey) Sign(data []byte) ([]byte, error) {
+	if k.PrivateKey == nil {
+		return nil, ErrPrivateKeyEmpty
+	}
+	return Sign(k.PrivateKey, data)
+}
+
+func (k *SignatureKey) Verify(data, signature []byte) error {
+	return Verify(k.PublicKey, data, signature)
+}
+
+type jwsHeader struct {
+	Alg  string   `json:"alg"`
+	Kid  string   `json:"kid,omitempty"`
+	B64  *bool    `json:"b64,omitempty"`
+	Crit []string `json:"crit,omitempty"`
+}
+
+// SignDetached 生成JWS compact格式的分离签名header..signature，使用RFC 7797的未编码载荷，
+// 载荷不需要base64编码，可以流式计算
+func (k *SignatureKey) SignDetached(payload io.Reader) (string, error) {
+	if k.PrivateKey == nil {
+		return "", ErrPrivateKeyEmpty
+	}
+	b64 := false
+	header, err := json.Marshal(jwsHeader{Alg: k.Algorithm(), Kid: k.KeyID, B64: &b64, Crit: []string{"b64"}})
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	signature, err := signReader(k.PrivateKey, io.MultiReader(strings.NewReader(protected+"."), payload))
+	if err != nil {
+		return "", err
+	}
+	return protected + ".." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// VerifyDetached 校验分离签名，同时支持未编码载荷及标准的base64载荷
+func (k *SignatureKey) VerifyDetached(jws string, payload io.Reader) error {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 || len(parts[1]) != 0 {
+		return ErrJWSInvalid
+	}
+	headerData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrJWSInvalid
+	}
+	var header jwsHeader
+	if err = json.Unmarshal(headerData, &header); err != nil {
+		return ErrJWSInvalid
+	}
+	if header.Alg != k.Algorithm() {
+		return fmt.Errorf("%w: unexpected alg %s", ErrJWSInvalid, header.Alg)
+	}
+	if len(k.KeyID) > 0 && len(header.Kid) > 0 && header.Kid != k.KeyID {
+		return fmt.Errorf("%w: unexpected kid %s", ErrJWSInvalid, header.Kid)
+	}
+	critB64 := false
+	for _, item := range header.Crit {
+		if item != "b64" {
+			return fmt.Errorf("%w: unsupported crit %s", ErrJWSInvalid, item)
+		}
+		critB64 = true
+	}
+	// RFC 7797 第6节，b64为false时必须在crit中声明
+	if header.B64 != nil && !*header.B64 && !critB64 {
+		return fmt.Errorf("%w: b64 must be listed in crit", ErrJWSInvalid)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrJWSInvalid
+	}
+	if header.B64 == nil || *header.B64 {
+		reader, writer := io.Pipe()
+		go func(source io.Reader) {
+			encoder := base64.NewEncoder(base64.RawURLEncoding, writer)
+			_, err := io.Copy(encoder, source)
+			if err == nil {
+				err = encoder.Close()
+			}
+			_ = writer.CloseWithError(err)
+		}(payload)
+		defer reader.Close()
+		payload = reader
+	}
+	return verifyReader(k.PublicKey, io.MultiReader(strings.NewReader(parts[0]+"."), payload), signature)
+}
+
+// SignFile 对文件生成分离签名
+func (k *SignatureKey) SignFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return k.SignDetached(f)
+}
+
+// VerifyFile 校验文件的分离签名
+func (k *SignatureKey) VerifyFile(jws, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return k.VerifyDetached(jws, f)
+}
+
+// Sign 使用RSA-PSS签名
+func (s *RsaSecurity) Sign(input []byte) ([]byte, error) {
+	if s.privateKey == nil {
+		return nil, ErrPrivateKeyEmpty
+	}
+	return Sign(s.privateKey, input)
+}
+
+// Verify 校验RSA-PSS签名
+func (s *RsaSecurity) Verify(input, signature []byte) error {
+	if s.publicKey == nil {
+		return ErrPublicKeyEmpty
+	}
+	return Verify(s.publicKey, input, signature)
+}
@@ -0,0 +1,107 @@
+package security
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignDetached(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	file := filepath.Join(t.TempDir(), "license")
+	if err := os.WriteFile(file, []byte(strings.Repeat("license data\n", 1000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, privateKey := range []crypto.Signer{rsaKey, ecKey, edKey} {
+		key := &SignatureKey{KeyID: "k1", PrivateKey: privateKey, PublicKey: privateKey.Public()}
+		signature, err := key.Sign([]byte("webhook body"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = Verify(privateKey.Public(), []byte("webhook body"), signature); err != nil {
+			t.Fatalf("%s: %v", key.Algorithm(), err)
+		}
+		if err = Verify(privateKey.Public(), []byte("other body"), signature); !errors.Is(err, ErrSignatureInvalid) {
+			t.Fatalf("%s: expected invalid signature, got %v", key.Algorithm(), err)
+		}
+		jws, err := key.SignFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifier := &SignatureKey{KeyID: "k1", PublicKey: privateKey.Public()}
+		if err = verifier.VerifyFile(jws, file); err != nil {
+			t.Fatalf("%s: %v", key.Algorithm(), err)
+		}
+		if err = verifier.VerifyDetached(jws, bytes.NewReader([]byte("tampered"))); !errors.Is(err, ErrSignatureInvalid) {
+			t.Fatalf("%s: expected invalid signature, got %v", key.Algorithm(), err)
+		}
+	}
+}
+
+func TestVerifyDetachedCrit(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key := &SignatureKey{KeyID: "k1", PrivateKey: ecKey, PublicKey: ecKey.Public()}
+	protected := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","kid":"k1","b64":false}`))
+	signature, err := key.Sign([]byte(protected + ".payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jws := protected + ".." + base64.RawURLEncoding.EncodeToString(signature)
+	if err = key.VerifyDetached(jws, strings.NewReader("payload")); !errors.Is(err, ErrJWSInvalid) {
+		t.Fatalf("expected invalid jws without crit, got %v", err)
+	}
+}
+
+func TestRsaSecurityEmptyKey(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := NewRsaSecurityFromRsaKey(&rsaKey.PublicKey, nil).Sign([]byte("data")); !errors.Is(err, ErrPrivateKeyEmpty) {
+		t.Fatalf("expected empty private key, got %v", err)
+	}
+	if err := NewRsaSecurityFromRsaKey(nil, rsaKey).Verify([]byte("data"), nil); !errors.Is(err, ErrPublicKeyEmpty) {
+		t.Fatalf("expected empty public key, got %v", err)
+	}
+	if _, err := (&SignatureKey{PublicKey: &rsaKey.PublicKey}).Sign([]byte("data")); !errors.Is(err, ErrPrivateKeyEmpty) {
+		t.Fatalf("expected empty private key, got %v", err)
+	}
+}
+
+func TestParsePEM(t *testing.T) {
+	privatePem, publicPem, err := GenerateRASPrivateAndPublicKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block, _ := pem.Decode(publicPem); block.Type != PEMTypePublicKey {
+		t.Fatalf("public key type: %s", block.Type)
+	}
+	key, err := NewSignatureKeyFromPEM(privatePem, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 旧版本生成的RSA PUBLIC KEY标签的PKIX公钥
+	block, _ := pem.Decode(publicPem)
+	legacy := pem.EncodeToMemory(&pem.Block{Type: PEMTypeRSAPublicKey, Bytes: block.Bytes})
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: PEMTypeRSAPublicKey, Bytes: x509.MarshalPKCS1PublicKey(key.PublicKey.(*rsa.PublicKey))})
+	for _, data := range [][]byte{publicPem, legacy, pkcs1} {
+		publicKey, err := ParsePublicKeyPEM(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !key.PublicKey.(*rsa.PublicKey).Equal(publicKey) {
+			t.Fatal("public key mismatch")
+		}
+	}
+}
@@ -22,7 +22,6 @@ import (
 	"encoding/base32"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/yaml.v3"
@@ -382,6 +381,7 @@ func GetStructJsonFields(v interface{}) (fields map[string]interface{}) {
 	return fields
 }
 
+// GeneratePassword 旧的密码哈希bcrypt(password+salt)，超过72字节的部分会被忽略，新代码应使用DefaultPasswordHasher.Hash
 func GeneratePassword(password, salt string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password+salt), bcrypt.DefaultCost) //加密处理
 	if err != nil {
@@ -390,11 +390,11 @@ func GeneratePassword(password, salt string) (string, error) {
 	return string(hash), nil
 
 }
+
+// ComparePassword 校验密码，支持GeneratePassword及PasswordHasher生成的哈希，需要重新生成哈希时使用DefaultPasswordHasher.Verify
 func ComparePassword(passwordHash string, password, salt string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password+salt))
-	if err != nil {
-		err = errors.New("username or password is not right")
+	if _, err := DefaultPasswordHasher.Verify(passwordHash, password, salt); err != nil {
+		return ErrPasswordMismatch
 	}
-	return err
-
+	return nil
 }